@@ -0,0 +1,98 @@
+package pubtkt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Authenticated encryption methods for tickets
+const (
+	MethodGcm              EncMethod = "GCM"
+	MethodChacha20Poly1305 EncMethod = "CHACHA20-POLY1305"
+)
+
+// Versions of the AEAD ticket envelope, the version gives the AEAD used.
+// An envelope is: version (1 byte) || nonce || ciphertext and tag, the version
+// byte is authenticated as associated data.
+const (
+	aeadVersionAES256GCM        byte = 1
+	aeadVersionChacha20Poly1305 byte = 2
+)
+
+// ErrTicketDecrypt is the only error given when a ticket can't be decrypted (or parsed once decrypted) with an AEAD method,
+// it doesn't tell why to not leak anything about the ticket.
+var ErrTicketDecrypt = errors.New("ticket can't be decrypted")
+
+// aeadVersion gives the envelope version of an AEAD method, false if the method is not an AEAD method
+func aeadVersion(method EncMethod) (byte, bool) {
+	switch EncMethod(strings.ToUpper(string(method))) {
+	case MethodGcm:
+		return aeadVersionAES256GCM, true
+	case MethodChacha20Poly1305:
+		return aeadVersionChacha20Poly1305, true
+	}
+	return 0, false
+}
+
+// newTicketAEAD gives the AEAD of the envelope version with a 256 bits key derived from the passphrase with HKDF-SHA256.
+func newTicketAEAD(passphrase string, version byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, []byte(passphrase), nil, []byte("go-auth-pubtkt ticket encryption")), key)
+	if err != nil {
+		return nil, err
+	}
+	switch version {
+	case aeadVersionAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case aeadVersionChacha20Poly1305:
+		return chacha20poly1305.New(key)
+	}
+	return nil, ErrTicketDecrypt
+}
+
+// encryptAEAD seals data in an envelope of the given version with a random nonce
+func encryptAEAD(passphrase string, data []byte, version byte) ([]byte, error) {
+	aead, err := newTicketAEAD(passphrase, version)
+	if err != nil {
+		return nil, err
+	}
+	envelope := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(data)+aead.Overhead())
+	envelope[0] = version
+	nonce := envelope[1:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(envelope, nonce, data, envelope[:1]), nil
+}
+
+// decryptAEAD opens an envelope, any failure gives ErrTicketDecrypt
+func decryptAEAD(passphrase string, envelope []byte) ([]byte, error) {
+	if len(envelope) == 0 {
+		return nil, ErrTicketDecrypt
+	}
+	aead, err := newTicketAEAD(passphrase, envelope[0])
+	if err != nil {
+		return nil, ErrTicketDecrypt
+	}
+	if len(envelope) < 1+aead.NonceSize()+aead.Overhead() {
+		return nil, ErrTicketDecrypt
+	}
+	nonce := envelope[1 : 1+aead.NonceSize()]
+	data, err := aead.Open(nil, nonce, envelope[1+aead.NonceSize():], envelope[:1])
+	if err != nil {
+		return nil, ErrTicketDecrypt
+	}
+	return data, nil
+}
@@ -0,0 +1,130 @@
+package pubtkt
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentSigner is a Signer creating signatures through a ssh-agent listening on a unix socket,
+// the private key never leaves the agent.
+// A new connection is made for each signature to survive agent restarts.
+type agentSigner struct {
+	socketPath string
+	key        *agent.Key
+	pubKey     PublicKey
+}
+
+// newAgentSigner gives a signer using the key from the ssh-agent which has keyName as SHA256
+// fingerprint (as shown by ssh-add -l) or as comment.
+// If keyName is empty, the agent must hold only one key.
+func newAgentSigner(socketPath, keyName string) (*agentSigner, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("error when connecting to ssh-agent: %s", err.Error())
+	}
+	defer conn.Close()
+
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil, fmt.Errorf("error when listing ssh-agent keys: %s", err.Error())
+	}
+	var found []*agent.Key
+	for _, key := range keys {
+		if keyName == "" || key.Comment == keyName || ssh.FingerprintSHA256(key) == keyName {
+			found = append(found, key)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no key %s found in ssh-agent", keyName)
+	}
+	if len(found) > 1 {
+		return nil, fmt.Errorf("more than one key found in ssh-agent, a key must be chosen with TKTAuthAgentKey")
+	}
+
+	sshPubKey, err := ssh.ParsePublicKey(found[0].Blob)
+	if err != nil {
+		return nil, fmt.Errorf("error when parse ssh-agent key: %s", err.Error())
+	}
+	cryptoPubKey, ok := sshPubKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported ssh-agent key type %s", sshPubKey.Type())
+	}
+	pubKey, err := NewPublicKey(cryptoPubKey.CryptoPublicKey())
+	if err != nil {
+		return nil, err
+	}
+	return &agentSigner{
+		socketPath: socketPath,
+		key:        found[0],
+		pubKey:     pubKey,
+	}, nil
+}
+
+func (s *agentSigner) PublicKey() PublicKey {
+	return s.pubKey
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+func (s *agentSigner) SignWithAlgorithm(_ io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	flags, err := s.signatureFlags(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", s.socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("error when connecting to ssh-agent: %s", err.Error())
+	}
+	defer conn.Close()
+
+	sig, err := agent.NewClient(conn).SignWithFlags(s.key, data, flags)
+	if err != nil {
+		return nil, err
+	}
+	if sig.Format == KeyAlgoDSA {
+		// ssh-agent gives r and s as two 20 bytes integers, use ASN.1 like dsaPrivateKey does
+		if len(sig.Blob) != 40 {
+			return nil, fmt.Errorf("invalid ssh-dss signature from ssh-agent")
+		}
+		blob, err := asn1.Marshal(struct {
+			R, S *big.Int
+		}{new(big.Int).SetBytes(sig.Blob[:20]), new(big.Int).SetBytes(sig.Blob[20:])})
+		if err != nil {
+			return nil, err
+		}
+		sig.Blob = blob
+	}
+	return sig, nil
+}
+
+// signatureFlags gives the flags to ask the agent for the given signature algorithm.
+// An agent only signs with the digests from the SSH protocol: SHA-1, SHA-256 and SHA-512 for RSA keys
+// and the digest matching the curve for ECDSA keys.
+func (s *agentSigner) signatureFlags(algorithm string) (agent.SignatureFlags, error) {
+	if algorithm == "" || algorithm == s.pubKey.Type() {
+		return 0, nil
+	}
+	switch pubKey := s.pubKey.(type) {
+	case *rsaPublicKey:
+		switch algorithm {
+		case SigAlgoRSASHA2256:
+			return agent.SignatureFlagRsaSha256, nil
+		case SigAlgoRSASHA2512:
+			return agent.SignatureFlagRsaSha512, nil
+		}
+	case *ecdsaPublicKey:
+		hash, err := pubKey.hash(algorithm)
+		if err == nil && hash == ecHash(pubKey.Curve) {
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("ssh-agent doesn't support signature algorithm %s with key type %s", algorithm, s.pubKey.Type())
+}
@@ -0,0 +1,163 @@
+package pubtkt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// bauthMethod gives the bauth encryption method and its allowed key sizes, cbc by default
+func bauthMethod(method EncMethod) (EncMethod, []int, error) {
+	switch EncMethod(strings.ToUpper(string(method))) {
+	case "", MethodCbc:
+		// AES-128 as mod_auth_pubtkt does, AES-192 and AES-256 keys have always been accepted
+		return MethodCbc, []int{16, 24, 32}, nil
+	case MethodGcm:
+		return MethodGcm, []int{32}, nil
+	}
+	return "", nil, fmt.Errorf("unsupported bauth encryption method %s, it can be either cbc or gcm", method)
+}
+
+// CheckBauthKey ensures that the key has a size allowed by the bauth encryption method
+func CheckBauthKey(keyStr string, method EncMethod) error {
+	method, keySizes, err := bauthMethod(method)
+	if err != nil {
+		return err
+	}
+	for _, keySize := range keySizes {
+		if len(keyStr) == keySize {
+			return nil
+		}
+	}
+	return NewErrBauthKeyLength(method, keySizes...)
+}
+
+// BauthDecrypt decrypts bauth encrypted with AES-128-CBC as mod_auth_pubtkt does
+func BauthDecrypt(bauth, keyStr string) (string, error) {
+	return BauthDecryptWithMethod(bauth, keyStr, MethodCbc)
+}
+
+// BauthEncrypt encrypts bauth with AES-128-CBC as mod_auth_pubtkt does
+func BauthEncrypt(plainData, keyStr string) (string, error) {
+	return BauthEncryptWithMethod(plainData, keyStr, MethodCbc)
+}
+
+// BauthDecryptWithMethod decrypts bauth with the given method:
+//   - cbc: AES-128-CBC with a 16 bytes key, as mod_auth_pubtkt does, without integrity check
+//     (24 and 32 bytes keys are also accepted for AES-192 and AES-256)
+//   - gcm: AES-256-GCM with a 32 bytes key
+//
+// It gives ErrBauthKeyLength if the key doesn't fit the method and ErrBauthDecrypt if bauth can't be decrypted.
+func BauthDecryptWithMethod(bauth, keyStr string, method EncMethod) (string, error) {
+	err := CheckBauthKey(keyStr, method)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(bauth)
+	if err != nil {
+		return "", NewErrBauthDecrypt()
+	}
+	block, err := aes.NewCipher([]byte(keyStr))
+	if err != nil {
+		return "", err
+	}
+	method, _, _ = bauthMethod(method)
+	if method == MethodGcm {
+		return bauthDecryptGCM(block, ciphertext)
+	}
+	return bauthDecryptCBC(block, ciphertext)
+}
+
+// BauthEncryptWithMethod encrypts bauth with the given method (see BauthDecryptWithMethod)
+func BauthEncryptWithMethod(plainData, keyStr string, method EncMethod) (string, error) {
+	err := CheckBauthKey(keyStr, method)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher([]byte(keyStr))
+	if err != nil {
+		return "", err
+	}
+	method, _, _ = bauthMethod(method)
+	var ciphertext []byte
+	if method == MethodGcm {
+		ciphertext, err = bauthEncryptGCM(block, []byte(plainData))
+	} else {
+		ciphertext, err = bauthEncryptCBC(block, []byte(plainData))
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// bauthDecryptCBC decrypts iv || ciphertext, mod_auth_pubtkt pads with NUL bytes,
+// they are trimmed when the PKCS#7 padding is not valid. Anything else is refused.
+func bauthDecryptCBC(block cipher.Block, ciphertext []byte) (string, error) {
+	// CBC mode always works in whole blocks, iv is at the beginning of the ciphertext.
+	if len(ciphertext) < 2*aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
+		return "", NewErrBauthDecrypt()
+	}
+	iv := ciphertext[:aes.BlockSize]
+	ciphertext = ciphertext[aes.BlockSize:]
+
+	mode := cipher.NewCBCDecrypter(block, iv)
+	mode.CryptBlocks(ciphertext, ciphertext)
+	ciphertextUnpad, err := pkcs7Unpad(ciphertext, aes.BlockSize)
+	if err == nil {
+		return string(ciphertextUnpad), nil
+	}
+	if ciphertext[len(ciphertext)-1] != 0 {
+		return "", NewErrBauthDecrypt()
+	}
+	return string(bytes.TrimRight(ciphertext, "\x00")), nil
+}
+
+func bauthEncryptCBC(block cipher.Block, plainData []byte) ([]byte, error) {
+	padded, err := pkcs7Pad(plainData, aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := make([]byte, aes.BlockSize+len(padded))
+	iv := ciphertext[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	mode := cipher.NewCBCEncrypter(block, iv)
+	mode.CryptBlocks(ciphertext[aes.BlockSize:], padded)
+	return ciphertext, nil
+}
+
+// bauthDecryptGCM opens nonce || ciphertext and tag
+func bauthDecryptGCM(block cipher.Block, ciphertext []byte) (string, error) {
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return "", NewErrBauthDecrypt()
+	}
+	data, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+	if err != nil {
+		return "", NewErrBauthDecrypt()
+	}
+	return string(data), nil
+}
+
+func bauthEncryptGCM(block cipher.Block, plainData []byte) ([]byte, error) {
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plainData)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plainData, nil), nil
+}
@@ -0,0 +1,119 @@
+package pubtkt
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// isCertificate tells if a trusted key is given as a PEM encoded X.509 certificate
+func isCertificate(pemKey string) bool {
+	block, _ := pem.Decode([]byte(pemKey))
+	return block != nil && block.Type == "CERTIFICATE"
+}
+
+// parseCACerts gives the pool of CAs from PEM encoded certificates, nil if there is none.
+func parseCACerts(pemCerts string) (*x509.CertPool, error) {
+	if strings.TrimSpace(pemCerts) == "" {
+		return nil, nil
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(pemCerts)) {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	return roots, nil
+}
+
+// extKeyUsages are the names accepted in TKTAuthCertExtKeyUsages, as used by openssl
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":             x509.ExtKeyUsageAny,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"OCSPSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// parseExtKeyUsages gives the extended key usages accepted for certificates from their names,
+// any usage is accepted (extended key usage is ignored) if there is none.
+func parseExtKeyUsages(names []string) ([]x509.ExtKeyUsage, error) {
+	if len(names) == 0 {
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageAny}, nil
+	}
+	usages := make([]x509.ExtKeyUsage, 0, len(names))
+	for _, name := range names {
+		usage, ok := extKeyUsages[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extended key usage %q", name)
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// parseCertificateChain parses a PEM bundle with the certificate of the ticket issuer first,
+// followed by its intermediate certificates if any.
+// It gives the issuer certificate and the options to verify it against the given roots,
+// the chain must allow one of keyUsages.
+func parseCertificateChain(pemCerts string, roots *x509.CertPool, keyUsages []x509.ExtKeyUsage) (*x509.Certificate, x509.VerifyOptions, error) {
+	if roots == nil {
+		return nil, x509.VerifyOptions{}, fmt.Errorf("TKTAuthCACerts must be set to verify certificates")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     keyUsages,
+	}
+	var cert *x509.Certificate
+	rest := []byte(pemCerts)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, opts, fmt.Errorf("unsupported PEM block type %q in certificate bundle", block.Type)
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, opts, err
+		}
+		if cert == nil {
+			cert = c
+			continue
+		}
+		opts.Intermediates.AddCert(c)
+	}
+	return cert, opts, nil
+}
+
+// checkCertificate ensures at the given time that the certificate chains to a trusted CA
+// and can be used to verify signatures.
+// It gives the validity window of the certificate: the latest NotBefore and the earliest NotAfter
+// of the certificates of all verified chains, chains are only built once, only this window must be checked afterward.
+func checkCertificate(cert *x509.Certificate, opts x509.VerifyOptions, now time.Time) (time.Time, time.Time, error) {
+	opts.CurrentTime = now
+	chains, err := cert.Verify(opts)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("certificate %s can't be used for digital signatures", cert.Subject)
+	}
+	notBefore, notAfter := cert.NotBefore, cert.NotAfter
+	for _, chain := range chains {
+		for _, c := range chain {
+			if c.NotBefore.After(notBefore) {
+				notBefore = c.NotBefore
+			}
+			if c.NotAfter.Before(notAfter) {
+				notAfter = c.NotAfter
+			}
+		}
+	}
+	return notBefore, notAfter, nil
+}
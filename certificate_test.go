@@ -0,0 +1,270 @@
+package pubtkt_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	. "github.com/orange-cloudfoundry/go-auth-pubtkt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Certificate", func() {
+	var defaultTicket *Ticket
+	var caCert, interCert, leafCert *x509.Certificate
+	var caKey, interKey, leafKey *ecdsa.PrivateKey
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		TimeNowFunc = func() time.Time {
+			return now
+		}
+		defaultTicket = &Ticket{
+			Uid:        "myuser",
+			Cip:        "127.0.0.1",
+			Validuntil: now.Add(time.Hour),
+			Tokens:     []string{"token1", "token2"},
+		}
+		caCert, caKey = newTestCertificate(&x509.Certificate{
+			Subject:               pkix.Name{CommonName: "ca"},
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}, nil, nil)
+		interCert, interKey = newTestCertificate(&x509.Certificate{
+			Subject:               pkix.Name{CommonName: "intermediate"},
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}, caCert, caKey)
+		leafCert, leafKey = newTestCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "issuer"},
+			KeyUsage: x509.KeyUsageDigitalSignature,
+		}, interCert, interKey)
+	})
+	It("should verify a ticket signed by the key of a certificate chained to the CA", func() {
+		signer, err := NewSignerFromKey(leafKey)
+		Expect(err).ToNot(HaveOccurred())
+		auth, err := NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey: pemCerts(leafCert, interCert),
+			TKTAuthCACerts:   pemCerts(caCert),
+			TKTAuthSigner:    signer,
+			TKTAuthHeader:    []string{"fake"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = auth.SignTicket(defaultTicket)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = auth.VerifyTicket(defaultTicket, "127.0.0.1")
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	It("should refuse a ticket when the certificate has expired", func() {
+		signer, err := NewSignerFromKey(leafKey)
+		Expect(err).ToNot(HaveOccurred())
+		auth, err := NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey: pemCerts(leafCert, interCert),
+			TKTAuthCACerts:   pemCerts(caCert),
+			TKTAuthSigner:    signer,
+			TKTAuthHeader:    []string{"fake"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		TimeNowFunc = func() time.Time {
+			return leafCert.NotAfter.Add(time.Minute)
+		}
+		defaultTicket.Validuntil = leafCert.NotAfter.Add(time.Hour)
+		err = auth.SignTicket(defaultTicket)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = auth.VerifyTicket(defaultTicket, "127.0.0.1")
+		Expect(err).Should(HaveOccurred())
+		_, isErrSigNotValid := err.(ErrSigNotValid)
+		Expect(isErrSigNotValid).Should(BeTrue())
+	})
+	It("should refuse a ticket when a certificate of the chain has expired", func() {
+		shortInterCert, shortInterKey := newTestCertificate(&x509.Certificate{
+			Subject:               pkix.Name{CommonName: "short intermediate"},
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			NotAfter:              now.Add(24 * time.Hour),
+		}, caCert, caKey)
+		shortLeafCert, shortLeafKey := newTestCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "issuer"},
+			KeyUsage: x509.KeyUsageDigitalSignature,
+		}, shortInterCert, shortInterKey)
+		signer, err := NewSignerFromKey(shortLeafKey)
+		Expect(err).ToNot(HaveOccurred())
+		auth, err := NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey: pemCerts(shortLeafCert, shortInterCert),
+			TKTAuthCACerts:   pemCerts(caCert),
+			TKTAuthSigner:    signer,
+			TKTAuthHeader:    []string{"fake"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = auth.SignTicket(defaultTicket)
+		Expect(err).ToNot(HaveOccurred())
+		err = auth.VerifyTicket(defaultTicket, "127.0.0.1")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		TimeNowFunc = func() time.Time {
+			return shortInterCert.NotAfter.Add(time.Minute)
+		}
+		defaultTicket.Validuntil = shortInterCert.NotAfter.Add(time.Hour)
+		err = auth.SignTicket(defaultTicket)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = auth.VerifyTicket(defaultTicket, "127.0.0.1")
+		Expect(err).To(BeAssignableToTypeOf(ErrSigNotValid("")))
+	})
+	It("should refuse a ticket when a certificate of any verified chain has expired", func() {
+		// same intermediate as interCert (subject and key) issued again for a shorter time: the leaf has 2 chains
+		shortInterTemplate := *interCert
+		shortInterTemplate.SerialNumber = big.NewInt(time.Now().UnixNano())
+		shortInterTemplate.NotAfter = now.Add(24 * time.Hour)
+		der, err := x509.CreateCertificate(rand.Reader, &shortInterTemplate, caCert, &interKey.PublicKey, caKey)
+		Expect(err).ToNot(HaveOccurred())
+		shortInterCert, err := x509.ParseCertificate(der)
+		Expect(err).ToNot(HaveOccurred())
+		signer, err := NewSignerFromKey(leafKey)
+		Expect(err).ToNot(HaveOccurred())
+		auth, err := NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey: pemCerts(leafCert, interCert, shortInterCert),
+			TKTAuthCACerts:   pemCerts(caCert),
+			TKTAuthSigner:    signer,
+			TKTAuthHeader:    []string{"fake"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = auth.SignTicket(defaultTicket)
+		Expect(err).ToNot(HaveOccurred())
+		err = auth.VerifyTicket(defaultTicket, "127.0.0.1")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		TimeNowFunc = func() time.Time {
+			return shortInterCert.NotAfter.Add(time.Minute)
+		}
+		defaultTicket.Validuntil = shortInterCert.NotAfter.Add(time.Hour)
+		err = auth.SignTicket(defaultTicket)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = auth.VerifyTicket(defaultTicket, "127.0.0.1")
+		Expect(err).To(BeAssignableToTypeOf(ErrSigNotValid("")))
+	})
+	It("should check the extended key usage of the certificate only when asked", func() {
+		serverCert, _ := newTestCertificate(&x509.Certificate{
+			Subject:     pkix.Name{CommonName: "issuer"},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, interCert, interKey)
+		_, err := NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey: pemCerts(serverCert, interCert),
+			TKTAuthCACerts:   pemCerts(caCert),
+			TKTAuthHeader:    []string{"fake"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey:        pemCerts(serverCert, interCert),
+			TKTAuthCACerts:          pemCerts(caCert),
+			TKTAuthCertExtKeyUsages: []string{"codeSigning", "clientAuth"},
+			TKTAuthHeader:           []string{"fake"},
+		})
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey:        pemCerts(serverCert, interCert),
+			TKTAuthCACerts:          pemCerts(caCert),
+			TKTAuthCertExtKeyUsages: []string{"codeSigning", "serverAuth"},
+			TKTAuthHeader:           []string{"fake"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey:        pemCerts(serverCert, interCert),
+			TKTAuthCACerts:          pemCerts(caCert),
+			TKTAuthCertExtKeyUsages: []string{"ticketSigning"},
+			TKTAuthHeader:           []string{"fake"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+	It("should complain when the certificate is not chained to the CA", func() {
+		otherCaCert, _ := newTestCertificate(&x509.Certificate{
+			Subject:               pkix.Name{CommonName: "other ca"},
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}, nil, nil)
+		_, err := NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey: pemCerts(leafCert, interCert),
+			TKTAuthCACerts:   pemCerts(otherCaCert),
+			TKTAuthHeader:    []string{"fake"},
+		})
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey: pemCerts(leafCert),
+			TKTAuthCACerts:   pemCerts(caCert),
+			TKTAuthHeader:    []string{"fake"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+	It("should complain when the certificate can't be used for digital signatures", func() {
+		encipherCert, _ := newTestCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "issuer"},
+			KeyUsage: x509.KeyUsageKeyEncipherment,
+		}, caCert, caKey)
+		_, err := NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey: pemCerts(encipherCert),
+			TKTAuthCACerts:   pemCerts(caCert),
+			TKTAuthHeader:    []string{"fake"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+	It("should complain when no CA is given", func() {
+		_, err := NewAuthPubTkt(AuthPubTktOptions{
+			TKTAuthPublicKey: pemCerts(leafCert, interCert),
+			TKTAuthHeader:    []string{"fake"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// newTestCertificate creates a certificate valid during 2024 (unless set in template) from template with a new P-256 key,
+// it is self-signed if parent is nil
+func newTestCertificate(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+	return cert, key
+}
+
+func pemCerts(certs ...*x509.Certificate) string {
+	var pemCerts []byte
+	for _, cert := range certs {
+		pemCerts = append(pemCerts, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return string(pemCerts)
+}
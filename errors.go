@@ -1,5 +1,10 @@
 package pubtkt
 
+import (
+	"fmt"
+	"strings"
+)
+
 type ErrNoTicket string
 
 func NewErrNoTicket() error {
@@ -74,3 +79,83 @@ func NewErrNoSig() error {
 func (e ErrNoSig) Error() string {
 	return string(e)
 }
+
+type ErrWeakAlgorithm string
+
+func NewErrWeakAlgorithm(algorithm string) error {
+	return ErrWeakAlgorithm("Signature algorithm not allowed: " + algorithm)
+}
+func (e ErrWeakAlgorithm) Error() string {
+	return string(e)
+}
+
+type ErrBauthKeyLength string
+
+func NewErrBauthKeyLength(method EncMethod, keySizes ...int) error {
+	sizes := make([]string, len(keySizes))
+	for i, keySize := range keySizes {
+		sizes[i] = fmt.Sprint(keySize)
+	}
+	return ErrBauthKeyLength(fmt.Sprintf("Bauth key must be %s characters long with %s method",
+		strings.Join(sizes, " or "), strings.ToLower(string(method))))
+}
+func (e ErrBauthKeyLength) Error() string {
+	return string(e)
+}
+
+type ErrBauthDecrypt string
+
+func NewErrBauthDecrypt() error {
+	return ErrBauthDecrypt("Bauth can't be decrypted")
+}
+func (e ErrBauthDecrypt) Error() string {
+	return string(e)
+}
+
+// ErrMalformedTicket is given when a ticket can't be parsed,
+// Offset is the position in the ticket of the faulty element (or value) of Field.
+type ErrMalformedTicket struct {
+	Field  string
+	Offset int
+	Reason string
+}
+
+func NewErrMalformedTicket(field string, offset int, reason string) error {
+	return ErrMalformedTicket{Field: field, Offset: offset, Reason: reason}
+}
+func (e ErrMalformedTicket) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("Malformed ticket at offset %d: %s", e.Offset, e.Reason)
+	}
+	return fmt.Sprintf("Malformed ticket at offset %d in field %s: %s", e.Offset, e.Field, e.Reason)
+}
+
+type ErrUnsafeTicketValue string
+
+func NewErrUnsafeTicketValue(field string) error {
+	return ErrUnsafeTicketValue(fmt.Sprintf("Value of field %s can't be written in a ticket without TKTAuthEscapeValues", field))
+}
+func (e ErrUnsafeTicketValue) Error() string {
+	return string(e)
+}
+
+type ErrUdataTooLarge string
+
+func NewErrUdataTooLarge(size, maxSize int) error {
+	return ErrUdataTooLarge(fmt.Sprintf("Udata is %d bytes long, it can't be larger than %d bytes", size, maxSize))
+}
+func (e ErrUdataTooLarge) Error() string {
+	return string(e)
+}
+
+type ErrUdataNotValid string
+
+func NewErrUdataNotValid(prevErrors ...error) error {
+	if len(prevErrors) == 0 {
+		return ErrUdataNotValid("Udata not valid.")
+	}
+	return ErrUdataNotValid("Udata not valid: " + prevErrors[0].Error())
+}
+func (e ErrUdataNotValid) Error() string {
+	return string(e)
+}
@@ -0,0 +1,93 @@
+package pubtkt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ticketReservedChars are the characters with a meaning in tickets, they are escaped by EscapeTicketValue
+const ticketReservedChars = "%;=,"
+
+// EscapeTicketValue escapes a ticket value with percent-encoding (like in urls) as done when TKTAuthEscapeValues is set.
+// Reserved characters (';', '=', ',' and '%'), spaces and control characters are escaped,
+// other characters are written as they are.
+func EscapeTicketValue(value string) string {
+	if !needsEscape(value) {
+		return value
+	}
+	var b strings.Builder
+	b.Grow(len(value) + 8)
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if isEscapedChar(c) {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// UnescapeTicketValue gives back a value escaped with EscapeTicketValue,
+// it fails if a '%' is not followed by 2 hexadecimal digits.
+func UnescapeTicketValue(value string) (string, error) {
+	unescaped, badIdx := unescapeValue(value)
+	if badIdx >= 0 {
+		return "", fmt.Errorf("invalid escape sequence at offset %d", badIdx)
+	}
+	return unescaped, nil
+}
+
+// unescapeValue gives the unescaped value, or the index of the first invalid escape sequence (-1 if there is none)
+func unescapeValue(value string) (string, int) {
+	if strings.IndexByte(value, '%') < 0 {
+		return value, -1
+	}
+	var b strings.Builder
+	b.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i+2 >= len(value) || !isHexDigit(value[i+1]) || !isHexDigit(value[i+2]) {
+			return "", i
+		}
+		b.WriteByte(unhex(value[i+1])<<4 | unhex(value[i+2]))
+		i += 2
+	}
+	return b.String(), -1
+}
+
+// unsafeTicketValue tells if a value can't be written as it is in a ticket, it would not be parsed back as it is.
+// separators are the characters which can't be in the value, they end the value.
+func unsafeTicketValue(value, separators string) bool {
+	return strings.ContainsAny(value, separators) || strings.TrimSpace(value) != value
+}
+
+func needsEscape(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if isEscapedChar(value[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isEscapedChar(c byte) bool {
+	return c <= ' ' || c == 0x7f || strings.IndexByte(ticketReservedChars, c) >= 0
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
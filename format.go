@@ -0,0 +1,38 @@
+package pubtkt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+)
+
+// TicketFormat is the format of a raw ticket as found in a request
+type TicketFormat string
+
+// Formats of raw tickets
+const (
+	// TicketFormatUnknown is given when the format can't be detected
+	TicketFormatUnknown TicketFormat = ""
+	// TicketFormatPlain is a ticket not encrypted (e.g.: uid=myuser;validuntil=...;sig=...), fields can be in any order
+	TicketFormatPlain TicketFormat = "plain"
+	// TicketFormatOpenSSL is a ticket encrypted like openssl enc with cbc or ecb method (base64 starting with Salted__)
+	TicketFormatOpenSSL TicketFormat = "openssl"
+	// TicketFormatAEAD is a ticket encrypted with gcm or chacha20-poly1305 method (base64 envelope)
+	TicketFormatAEAD TicketFormat = "aead"
+)
+
+// DetectTicketFormat gives the format of a raw ticket, it doesn't tell if the ticket is valid
+func DetectTicketFormat(raw string) TicketFormat {
+	// ';' is not in the base64 alphabet, a ticket with a signature field can't be encrypted
+	if strings.HasPrefix(raw, "uid=") || strings.Contains(raw, ";sig=") {
+		return TicketFormatPlain
+	}
+	data, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(data) == 0 {
+		return TicketFormatUnknown
+	}
+	if bytes.HasPrefix(data, []byte("Salted__")) {
+		return TicketFormatOpenSSL
+	}
+	return TicketFormatAEAD
+}
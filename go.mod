@@ -3,14 +3,13 @@ module github.com/orange-cloudfoundry/go-auth-pubtkt
 go 1.22.3
 
 require (
-	github.com/mitchellh/mapstructure v1.5.0
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/onsi/ginkgo v1.16.5
 	github.com/onsi/gomega v1.33.1
 	golang.org/x/crypto v0.23.0
 )
 
 require (
-	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/google/go-cmp v0.6.0 // indirect
 	github.com/nxadm/tail v1.4.11 // indirect
 	golang.org/x/net v0.25.0 // indirect
@@ -15,6 +15,9 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
 )
 
 const (
@@ -52,20 +55,61 @@ type EncMethod string
 
 type OpenSSL struct {
 	openSSLSaltHeader string
+	kdfHash           func() hash.Hash
+	pbkdf2Iterations  int
+}
+
+// OpenSSLKDF is the derivation of key and iv from the passphrase, as set with openssl enc options -md, -pbkdf2 and -iter
+type OpenSSLKDF struct {
+	// Digest used by the derivation: md5, sha1, sha224, sha256, sha384 or sha512 (like -md option)
+	// Default: md5 (openssl < 1.1 default) or sha256 when PBKDF2 is used (openssl default)
+	Digest string
+	// Iteration count of PBKDF2 (like -pbkdf2 -iter options, openssl default with -pbkdf2 is 10000)
+	// If 0, EVP_BytesToKey is used (like openssl without -pbkdf2 option)
+	PBKDF2Iterations int
 }
 
 func NewOpenSSL() *OpenSSL {
 	return &OpenSSL{
 		openSSLSaltHeader: "Salted__", // OpenSSL salt is always this string + 8 bytes of actual salt
+		kdfHash:           md5.New,
 	}
 }
 
+// NewOpenSSLWithKDF gives an OpenSSL deriving key and iv from passphrase with the given derivation
+func NewOpenSSLWithKDF(kdf OpenSSLKDF) (*OpenSSL, error) {
+	if kdf.PBKDF2Iterations < 0 {
+		return nil, fmt.Errorf("PBKDF2 iterations can't be negative")
+	}
+	digest := strings.ToLower(kdf.Digest)
+	if digest == "" && kdf.PBKDF2Iterations > 0 {
+		digest = string(Hsha256)
+	}
+	o := NewOpenSSL()
+	o.pbkdf2Iterations = kdf.PBKDF2Iterations
+	if digest == "" || digest == "md5" {
+		return o, nil
+	}
+	_, _, err := FindHash(digest)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported key derivation digest %s", kdf.Digest)
+	}
+	o.kdfHash = func() hash.Hash {
+		h, _, _ := FindHash(digest)
+		return h
+	}
+	return o, nil
+}
+
 // DecryptString - Decrypt string that was encrypted using OpenSSL and AES-256-CBC or AES-256-ECB
 func (o OpenSSL) DecryptString(passphrase, encryptedBase64String string, method EncMethod) ([]byte, error) {
 	data, err := base64.StdEncoding.DecodeString(encryptedBase64String)
 	if err != nil {
 		return nil, err
 	}
+	if len(data) < aes.BlockSize {
+		return nil, fmt.Errorf("bad data length %d, it must be at least aes.BlockSize = %d", len(data), aes.BlockSize)
+	}
 	saltHeader := data[:aes.BlockSize]
 	salt := saltHeader[8:]
 	isSalted := true
@@ -112,6 +156,9 @@ func (o OpenSSL) EncryptString(passphrase, plainData string, method EncMethod) (
 }
 
 func (o OpenSSL) decryptEcb(key, data []byte, isSalted bool) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("bad blocksize(%v), aes.BlockSize = %v", len(data), aes.BlockSize)
+	}
 	cipherKey, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -198,14 +245,25 @@ func (o OpenSSL) GenerateSalt() ([]byte, error) {
 // It uses the EVP_BytesToKey() method which is basically:
 // D_i = HASH^count(D_(i-1) || password || salt) where || denotes concatentaion, until there are sufficient bytes available
 // 48 bytes since we're expecting to handle AES-256, 32bytes for a key and 16bytes for the IV
+// When PBKDF2 is used, the 48 bytes are PBKDF2(password, salt) like openssl enc -pbkdf2 does.
 func (o OpenSSL) extractOpenSSLCreds(password, salt []byte) (OpenSSLCreds, error) {
-	m := make([]byte, 48)
+	return o.deriveOpenSSLCreds(password, salt, 32)
+}
+
+// deriveOpenSSLCreds is extractOpenSSLCreds for a key of keyLen bytes (AES-128, AES-192 or AES-256)
+func (o OpenSSL) deriveOpenSSLCreds(password, salt []byte, keyLen int) (OpenSSLCreds, error) {
+	credsLen := keyLen + aes.BlockSize
+	if o.pbkdf2Iterations > 0 {
+		m := pbkdf2.Key(password, salt, o.pbkdf2Iterations, credsLen, o.kdfHash)
+		return OpenSSLCreds{key: m[:keyLen], iv: m[keyLen:]}, nil
+	}
+	m := make([]byte, 0, credsLen)
 	prev := []byte{}
-	for i := 0; i < 3; i++ {
+	for len(m) < credsLen {
 		prev = o.hash(prev, password, salt)
-		copy(m[i*16:], prev)
+		m = append(m, prev...)
 	}
-	return OpenSSLCreds{key: m[:32], iv: m[32:]}, nil
+	return OpenSSLCreds{key: m[:keyLen], iv: m[keyLen:credsLen]}, nil
 }
 
 func (o OpenSSL) hash(prev, password, salt []byte) []byte {
@@ -213,12 +271,8 @@ func (o OpenSSL) hash(prev, password, salt []byte) []byte {
 	copy(a, prev)
 	copy(a[len(prev):], password)
 	copy(a[len(prev)+len(password):], salt)
-	return o.md5sum(a)
-}
-
-func (o OpenSSL) md5sum(data []byte) []byte {
-	h := md5.New()
-	h.Write(data)
+	h := o.kdfHash()
+	h.Write(a)
 	return h.Sum(nil)
 }
 
@@ -330,55 +384,3 @@ func (x *ecbEncrypter) CryptBlocks(dst, src []byte) {
 		dst = dst[x.blockSize:]
 	}
 }
-
-func BauthDecrypt(bauth, keyStr string) (string, error) {
-	key := []byte(keyStr)
-	ciphertext, _ := base64.StdEncoding.DecodeString(bauth)
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-	// include it at the beginning of the ciphertext.
-	if len(ciphertext) < aes.BlockSize {
-		return "", fmt.Errorf("ciphertext too short")
-	}
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-	// CBC mode always works in whole blocks.
-	if len(ciphertext)%aes.BlockSize != 0 {
-		return "", fmt.Errorf("ciphertext is not a multiple of the block size")
-	}
-
-	mode := cipher.NewCBCDecrypter(block, iv)
-	mode.CryptBlocks(ciphertext, ciphertext)
-	ciphertextUnpad, err := pkcs7Unpad(ciphertext, aes.BlockSize)
-	if err != nil {
-		if err.Error() == "invalid padding" {
-			return string(bytes.Trim(ciphertext, "\x00")), nil
-		}
-		return "", err
-	}
-	return string(ciphertextUnpad), nil
-}
-
-func BauthEncrypt(plainData, keyStr string) (string, error) {
-	key := []byte(keyStr)
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-
-	padded, err := pkcs7Pad([]byte(plainData), aes.BlockSize)
-	if err != nil {
-		return "", err
-	}
-
-	ciphertext := make([]byte, aes.BlockSize+len(padded))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		panic(err)
-	}
-	mode := cipher.NewCBCEncrypter(block, iv)
-	mode.CryptBlocks(ciphertext[aes.BlockSize:], padded)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
-}
@@ -1,6 +1,12 @@
 package pubtkt_test
 
 import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing/iotest"
+
 	. "github.com/orange-cloudfoundry/go-auth-pubtkt"
 
 	. "github.com/onsi/ginkgo"
@@ -39,6 +45,59 @@ var _ = Describe("Hash", func() {
 				Expect(string(result)).Should(Equal(expectedValue))
 			})
 		})
+		It("should fail without panicking when data is too short or not made of whole blocks", func() {
+			for _, method := range []EncMethod{MethodEcb, MethodCbc} {
+				for _, encrypted := range []string{"", "c2hvcnQ=", "U2FsdGVkX1+EqZns6jnWZVbZqE7e+Itx"} {
+					_, err := NewOpenSSL().DecryptString(passPhraseEcb, encrypted, method)
+					Expect(err).To(HaveOccurred(), "%s %s", method, encrypted)
+				}
+			}
+		})
+	})
+	Context("With key derivation", func() {
+		It("should decode a value encrypted with openssl enc -md sha256", func() {
+			openSSL, err := NewOpenSSLWithKDF(OpenSSLKDF{Digest: "sha256"})
+			Expect(err).ToNot(HaveOccurred())
+			result, err := openSSL.DecryptString(passPhraseEcb, "U2FsdGVkX18BPHgE2R93KTNq9P17HxwQpwv5YKF/poI=", MethodCbc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).Should(Equal(expectedValue))
+		})
+		It("should decode a value encrypted with openssl enc -pbkdf2", func() {
+			// made with: openssl enc -aes-256-cbc -pbkdf2 -iter 1000
+			openSSL, err := NewOpenSSLWithKDF(OpenSSLKDF{PBKDF2Iterations: 1000})
+			Expect(err).ToNot(HaveOccurred())
+			result, err := openSSL.DecryptString(passPhraseEcb, "U2FsdGVkX1/eLjOd0cqhr91FrxoX/nWjf+mIkGhQMbI=", MethodCbc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).Should(Equal(expectedValue))
+
+			// made with: openssl enc -aes-256-cbc -pbkdf2 -md sha512
+			openSSL, err = NewOpenSSLWithKDF(OpenSSLKDF{Digest: "SHA512", PBKDF2Iterations: 10000})
+			Expect(err).ToNot(HaveOccurred())
+			result, err = openSSL.DecryptString(passPhraseEcb, "U2FsdGVkX19eLuOiNDV2iQTIJdZG6Sleb0Hdrww6eJI=", MethodCbc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).Should(Equal(expectedValue))
+
+			// made with: openssl enc -aes-256-ecb -pbkdf2
+			openSSL, err = NewOpenSSLWithKDF(OpenSSLKDF{PBKDF2Iterations: 10000})
+			Expect(err).ToNot(HaveOccurred())
+			result, err = openSSL.DecryptString(passPhraseEcb, "U2FsdGVkX1+EyJXp5qQW14DCTjimaZEr6Dbef6o4ZVk=", MethodEcb)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).Should(Equal(expectedValue))
+		})
+		It("should encode correctly with pbkdf2", func() {
+			openSSL, err := NewOpenSSLWithKDF(OpenSSLKDF{Digest: "sha1", PBKDF2Iterations: 100})
+			Expect(err).ToNot(HaveOccurred())
+			crypted, err := openSSL.EncryptString(passPhraseEcb, "data", MethodCbc)
+			Expect(err).ToNot(HaveOccurred())
+
+			result, err := openSSL.DecryptString(passPhraseEcb, string(crypted), MethodCbc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).Should(Equal(expectedValue))
+		})
+		It("should complain about an unknown digest", func() {
+			_, err := NewOpenSSLWithKDF(OpenSSLKDF{Digest: "md4"})
+			Expect(err).To(HaveOccurred())
+		})
 	})
 	Context("EncrypString", func() {
 		Context("With ecb encryption", func() {
@@ -73,6 +132,37 @@ var _ = Describe("Hash", func() {
 		})
 	})
 
+	Context("BauthDecrypt with a wrong key or a tampered value", func() {
+		It("Should give ErrBauthDecrypt instead of garbage", func() {
+			cryptedBauth := "6EAv9/i8HmAN3yr681s8OsNXJ4Xw0Qe70taHuUNvV7k=" // == mydata with AZERTYUIOPQSDFGH
+			failures := 0
+			for _, key := range []string{"AZERTYUIOPQSDFGJ", "0123456789ABCDEF", "QSDFGHJKLMWXCVBN"} {
+				res, err := BauthDecrypt(cryptedBauth, key)
+				if err != nil {
+					Expect(err).Should(BeAssignableToTypeOf(ErrBauthDecrypt("")))
+					failures++
+					continue
+				}
+				// a random last byte can still be a valid padding (e.g. 0x01), it must not be mydata
+				Expect(res).ShouldNot(Equal("mydata"))
+			}
+			Expect(failures).Should(BeNumerically(">", 0))
+		})
+	})
+
+	Context("BauthEncrypt with AES-192 and AES-256 keys", func() {
+		It("Should encrypt and decrypt bauth with cbc", func() {
+			for _, key := range []string{"0123456789ABCDEF01234567", "0123456789ABCDEF0123456789ABCDEF"} {
+				crypted, err := BauthEncrypt("mydata", key)
+				Expect(err).ToNot(HaveOccurred())
+
+				res, err := BauthDecrypt(crypted, key)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(res).Should(Equal("mydata"))
+			}
+		})
+	})
+
 	Context("BauthEncryp", func() {
 		It("Should encrypt bauth from aes-128-cbc", func() {
 			key := "AZERTYUIOPQSDFGH"
@@ -85,4 +175,137 @@ var _ = Describe("Hash", func() {
 			Expect(res).Should(Equal("mydata"))
 		})
 	})
+
+	Context("BauthEncryptWithMethod", func() {
+		key := "0123456789ABCDEF0123456789ABCDEF"
+		It("Should encrypt and decrypt bauth with aes-256-gcm", func() {
+			crypted, err := BauthEncryptWithMethod("mydata", key, MethodGcm)
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := BauthDecryptWithMethod(crypted, key, "gcm")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).Should(Equal("mydata"))
+		})
+		It("Should give typed errors", func() {
+			_, err := BauthEncryptWithMethod("mydata", "AZERTYUIOPQSDFGH", MethodGcm)
+			Expect(err).Should(BeAssignableToTypeOf(ErrBauthKeyLength("")))
+			_, err = BauthDecrypt("6EAv9/i8HmAN3yr681s8OsNXJ4Xw0Qe70taHuUNvV7k=", "0123456789ABCDEF0123")
+			Expect(err).Should(BeAssignableToTypeOf(ErrBauthKeyLength("")))
+
+			crypted, err := BauthEncryptWithMethod("mydata", key, MethodGcm)
+			Expect(err).ToNot(HaveOccurred())
+			tampered := []byte(crypted)
+			tampered[2] ^= 1
+			_, err = BauthDecryptWithMethod(string(tampered), key, MethodGcm)
+			Expect(err).Should(BeAssignableToTypeOf(ErrBauthDecrypt("")))
+
+			_, err = BauthDecryptWithMethod("not base64", key, MethodGcm)
+			Expect(err).Should(BeAssignableToTypeOf(ErrBauthDecrypt("")))
+			_, err = BauthDecrypt("not base64", "AZERTYUIOPQSDFGH")
+			Expect(err).Should(BeAssignableToTypeOf(ErrBauthDecrypt("")))
+
+			_, err = BauthDecryptWithMethod(crypted, key, "ctr")
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+	Context("Streams", func() {
+		passphrase := "mysuperpassphrase"
+		plain := strings.Repeat("0123456789", 10) + "end of stream"
+		vectors := []struct {
+			openSSL *OpenSSL
+			opts    OpenSSLStreamOptions
+			data    string
+		}{
+			{
+				// openssl enc -aes-128-cbc -a -md md5
+				openSSL: NewOpenSSL(),
+				opts:    OpenSSLStreamOptions{Cipher: CipherAES128CBC, Base64: true},
+				data: "U2FsdGVkX18pP0hhkEfEuh5wXaIcSVKhOSGV05cCChQt/N1rVi8IHtoFoZsZ521t\n" +
+					"Ua8+zIQHYpjDHd1aNJIYUf0yTMfYNeLoD8cT/bKZqj9HXs4XCCdtdnEAOhxJq4S0\n" +
+					"zyVG6Omga80EH7kWKxnqdkmkBJmnRx1LLglNagImQHR6MiK5II0bDr8Izo87I15H\n",
+			},
+			{
+				// openssl enc -aes-192-ctr -a -md md5
+				openSSL: NewOpenSSL(),
+				opts:    OpenSSLStreamOptions{Cipher: CipherAES192CTR, Base64: true},
+				data: "U2FsdGVkX1+BLlqMnxwy4T3D8hHV6Jn6ESldIKZIzi2GbeJiDvP50WMoMoiBTr/O\n" +
+					"N0U1a2muFno5iQyH6shuRe50zi0rxalUEHp84Ox4ItvciBliH150Z8f/hdu64RKL\n" +
+					"KfVNyRpMl/bU0QDQp0VymSg1E6db/mKu+r+Yu2GHnf9X\n",
+			},
+			{
+				// openssl enc -aes-256-ctr -pbkdf2 -iter 1000 | base64
+				openSSL: mustNewOpenSSLWithKDF(OpenSSLKDF{PBKDF2Iterations: 1000}),
+				opts:    OpenSSLStreamOptions{Cipher: CipherAES256CTR},
+				data: mustBase64Decode("U2FsdGVkX1/bWmpupY3eONo8KcLGKx9igb43N4SIodWJB0K7tFFOKQE+Q5DZAhsQqAEAIyBZaWs3B64eqCtFTpMjpETh063K" +
+					"m+eqOa5OE7khXWIH3ag6HyYlRy/8ULge/4FvqJCch5dmPDrt5xcZ0vCWan8oKO47QM3ijoqgVBmC"),
+			},
+			{
+				// openssl enc -aes-192-cbc -pbkdf2 | base64
+				openSSL: mustNewOpenSSLWithKDF(OpenSSLKDF{PBKDF2Iterations: 10000}),
+				opts:    OpenSSLStreamOptions{Cipher: CipherAES192CBC},
+				data: mustBase64Decode("U2FsdGVkX1/Rgs45JtEHUJcZN73TNR8JNcATq4Maid89HiEmfeQORQRCeEg05e2/6VKgTstA/dsQIlrgibawpKICPBBVSQ1M" +
+					"4MRUeKbVrkT/CChNaP554yWoyoaxWzdOAsB4sFCVo+zXJ3BWSGtE9S6tjCJbehtiSI1+9DZHuOhsmomPOSQdZ8OqC+8Bjbt/"),
+			},
+		}
+		It("should decrypt streams encrypted with openssl", func() {
+			for _, vector := range vectors {
+				var out bytes.Buffer
+				src := iotest.OneByteReader(strings.NewReader(vector.data))
+				err := vector.openSSL.DecryptStream(&out, src, passphrase, vector.opts)
+				Expect(err).ToNot(HaveOccurred(), string(vector.opts.Cipher))
+				Expect(out.String()).To(Equal(plain))
+			}
+		})
+		It("should encrypt streams which can be decrypted", func() {
+			for _, vector := range vectors {
+				for _, size := range []int{0, 15, 16, len(plain)} {
+					var enc bytes.Buffer
+					err := vector.openSSL.EncryptStream(&enc, iotest.HalfReader(strings.NewReader(plain[:size])), passphrase, vector.opts)
+					Expect(err).ToNot(HaveOccurred())
+					if vector.opts.Base64 {
+						for _, line := range strings.Split(strings.TrimSuffix(enc.String(), "\n"), "\n") {
+							Expect(len(line)).To(BeNumerically("<=", 64))
+						}
+					}
+
+					var out bytes.Buffer
+					err = vector.openSSL.DecryptStream(&out, &enc, passphrase, vector.opts)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(out.String()).To(Equal(plain[:size]))
+				}
+			}
+		})
+		It("should fail when stream is not valid", func() {
+			opts := OpenSSLStreamOptions{Cipher: CipherAES128CBC, Base64: true}
+			err := NewOpenSSL().DecryptStream(io.Discard, strings.NewReader(vectors[0].data), "wrongpassphrase", opts)
+			Expect(err).To(HaveOccurred())
+
+			truncated := mustBase64Decode(strings.ReplaceAll(vectors[0].data, "\n", ""))
+			truncated = truncated[:len(truncated)-1]
+			err = NewOpenSSL().DecryptStream(io.Discard, strings.NewReader(truncated), passphrase, OpenSSLStreamOptions{Cipher: CipherAES128CBC})
+			Expect(err).To(HaveOccurred())
+
+			err = NewOpenSSL().DecryptStream(io.Discard, strings.NewReader("not salted data"), passphrase, OpenSSLStreamOptions{})
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewOpenSSL().NewEncryptWriter(io.Discard, passphrase, OpenSSLStreamOptions{Cipher: "aes-256-ofb"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
+
+func mustNewOpenSSLWithKDF(kdf OpenSSLKDF) *OpenSSL {
+	openSSL, err := NewOpenSSLWithKDF(kdf)
+	if err != nil {
+		panic(err)
+	}
+	return openSSL
+}
+
+func mustBase64Decode(data string) string {
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		panic(err)
+	}
+	return string(decoded)
+}
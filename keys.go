@@ -11,6 +11,9 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/md5"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -48,6 +51,26 @@ const (
 	SigAlgoRSASHA2512 = "rsa-sha2-512"
 )
 
+// These constants represent signature algorithms for RSA keys with SHA-224 and
+// SHA-384 digests. Like the SigAlgoECDSA* constants they are not part of the SSH
+// protocol and only exist to produce OpenSSL-like signatures.
+const (
+	SigAlgoRSASHA2224 = "rsa-sha2-224"
+	SigAlgoRSASHA2384 = "rsa-sha2-384"
+)
+
+// These constants represent signature algorithms for ECDSA keys using a digest
+// other than the one mandated by RFC 5656 for the key curve. They are not part
+// of the SSH protocol, they only exist to produce OpenSSL-like signatures where
+// the digest is chosen by the caller (e.g. ticket signatures).
+const (
+	SigAlgoECDSASHA1   = "ecdsa-sha1"
+	SigAlgoECDSASHA224 = "ecdsa-sha224"
+	SigAlgoECDSASHA256 = "ecdsa-sha256"
+	SigAlgoECDSASHA384 = "ecdsa-sha384"
+	SigAlgoECDSASHA512 = "ecdsa-sha512"
+)
+
 // parseAuthorizedKey parses a public key in OpenSSH authorized_keys format
 // (see sshd(8) manual page) once the options and key type fields have been
 // removed.
@@ -235,8 +258,12 @@ func (r *rsaPublicKey) Verify(data []byte, sig *ssh.Signature) error {
 	switch sig.Format {
 	case SigAlgoRSA:
 		hash = crypto.SHA1
+	case SigAlgoRSASHA2224:
+		hash = crypto.SHA224
 	case SigAlgoRSASHA2256:
 		hash = crypto.SHA256
+	case SigAlgoRSASHA2384:
+		hash = crypto.SHA384
 	case SigAlgoRSASHA2512:
 		hash = crypto.SHA512
 	default:
@@ -344,8 +371,149 @@ func (k *dsaPrivateKey) SignWithAlgorithm(rand io.Reader, data []byte, algorithm
 	}, nil
 }
 
+type ecdsaPublicKey ecdsa.PublicKey
+
+func (k *ecdsaPublicKey) Type() string {
+	return "ecdsa-sha2-" + k.nistID()
+}
+
+func (k *ecdsaPublicKey) nistID() string {
+	switch k.Params().BitSize {
+	case 256:
+		return "nistp256"
+	case 384:
+		return "nistp384"
+	case 521:
+		return "nistp521"
+	}
+	panic("ssh: unsupported ecdsa key size")
+}
+
+// hash returns the hash function used by the given ECDSA signature algorithm.
+func (k *ecdsaPublicKey) hash(algorithm string) (crypto.Hash, error) {
+	switch algorithm {
+	case k.Type():
+		return ecHash(k.Curve), nil
+	case SigAlgoECDSASHA1:
+		return crypto.SHA1, nil
+	case SigAlgoECDSASHA224:
+		return crypto.SHA224, nil
+	case SigAlgoECDSASHA256:
+		return crypto.SHA256, nil
+	case SigAlgoECDSASHA384:
+		return crypto.SHA384, nil
+	case SigAlgoECDSASHA512:
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("ssh: signature type %s for key type %s", algorithm, k.Type())
+	}
+}
+
+// ecHash returns the hash to match the given elliptic curve, see RFC
+// 5656, section 6.2.1
+func ecHash(curve elliptic.Curve) crypto.Hash {
+	bitSize := curve.Params().BitSize
+	switch {
+	case bitSize <= 256:
+		return crypto.SHA256
+	case bitSize <= 384:
+		return crypto.SHA384
+	}
+	return crypto.SHA512
+}
+
+func supportedEllipticCurve(curve elliptic.Curve) bool {
+	return curve == elliptic.P256() || curve == elliptic.P384() || curve == elliptic.P521()
+}
+
+func (k *ecdsaPublicKey) Marshal() []byte {
+	// See RFC 5656, section 3.1.
+	keyBytes := elliptic.Marshal(k.Curve, k.X, k.Y)
+	// ECDSA publickey struct layout should match the struct used by
+	// parseECDSACert in the x/crypto/ssh/agent package.
+	w := struct {
+		Name string
+		ID   string
+		Key  []byte
+	}{
+		k.Type(),
+		k.nistID(),
+		keyBytes,
+	}
+
+	return ssh.Marshal(&w)
+}
+
+func (k *ecdsaPublicKey) Verify(data []byte, sig *ssh.Signature) error {
+	hash, err := k.hash(sig.Format)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	// Per RFC 5656, section 3.1.2,
+	// The ecdsa_signature_blob value has the following specific encoding:
+	//    mpint    r
+	//    mpint    s
+	var ecSig struct {
+		R *big.Int
+		S *big.Int
+	}
+
+	if err := ssh.Unmarshal(sig.Blob, &ecSig); err != nil {
+		return err
+	}
+
+	if ecdsa.Verify((*ecdsa.PublicKey)(k), digest, ecSig.R, ecSig.S) {
+		return nil
+	}
+	return errors.New("ssh: signature did not verify")
+}
+
+func (k *ecdsaPublicKey) CryptoPublicKey() crypto.PublicKey {
+	return (*ecdsa.PublicKey)(k)
+}
+
+type ed25519PublicKey ed25519.PublicKey
+
+func (k ed25519PublicKey) Type() string {
+	return KeyAlgoED25519
+}
+
+func (k ed25519PublicKey) Marshal() []byte {
+	w := struct {
+		Name     string
+		KeyBytes []byte
+	}{
+		KeyAlgoED25519,
+		[]byte(k),
+	}
+	return ssh.Marshal(&w)
+}
+
+func (k ed25519PublicKey) Verify(b []byte, sig *ssh.Signature) error {
+	if sig.Format != k.Type() {
+		return fmt.Errorf("ssh: signature type %s for key type %s", sig.Format, k.Type())
+	}
+	if l := len(k); l != ed25519.PublicKeySize {
+		return fmt.Errorf("ssh: invalid size %d for Ed25519 public key", l)
+	}
+
+	if ok := ed25519.Verify(ed25519.PublicKey(k), b, sig.Blob); !ok {
+		return errors.New("ssh: signature did not verify")
+	}
+
+	return nil
+}
+
+func (k ed25519PublicKey) CryptoPublicKey() crypto.PublicKey {
+	return ed25519.PublicKey(k)
+}
+
 // NewSignerFromKey takes an *rsa.PrivateKey, *dsa.PrivateKey,
-// *ecdsa.PrivateKey or any other crypto.Signer and returns a
+// *ecdsa.PrivateKey, ed25519.PrivateKey or any other crypto.Signer and returns a
 // corresponding Signer instance. ECDSA keys must use P-256, P-384 or
 // P-521. DSA keys must use parameter size L1024N160.
 func NewSignerFromKey(key interface{}) (Signer, error) {
@@ -372,12 +540,25 @@ type wrappedSigner struct {
 	pubKey PublicKey
 }
 
+// NewPublicKey takes an *rsa.PublicKey, *dsa.PublicKey, *ecdsa.PublicKey
+// or ed25519.PublicKey and returns a corresponding PublicKey instance.
+// ECDSA keys must use P-256, P-384 or P-521.
 func NewPublicKey(key interface{}) (PublicKey, error) {
 	switch key := key.(type) {
 	case *rsa.PublicKey:
 		return (*rsaPublicKey)(key), nil
+	case *ecdsa.PublicKey:
+		if !supportedEllipticCurve(key.Curve) {
+			return nil, errors.New("ssh: only P-256, P-384 and P-521 EC keys are supported")
+		}
+		return (*ecdsaPublicKey)(key), nil
 	case *dsa.PublicKey:
 		return (*dsaPublicKey)(key), nil
+	case ed25519.PublicKey:
+		if l := len(key); l != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("ssh: invalid size %d for Ed25519 public key", l)
+		}
+		return ed25519PublicKey(key), nil
 	default:
 		return nil, fmt.Errorf("ssh: unsupported key type %T", key)
 	}
@@ -412,13 +593,27 @@ func (s *wrappedSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm
 		case "", SigAlgoRSA:
 			algorithm = SigAlgoRSA
 			hashFunc = crypto.SHA1
+		case SigAlgoRSASHA2224:
+			hashFunc = crypto.SHA224
 		case SigAlgoRSASHA2256:
 			hashFunc = crypto.SHA256
+		case SigAlgoRSASHA2384:
+			hashFunc = crypto.SHA384
 		case SigAlgoRSASHA2512:
 			hashFunc = crypto.SHA512
 		default:
 			return nil, fmt.Errorf("ssh: unsupported signature algorithm %s", algorithm)
 		}
+	} else if ecKey, ok := s.pubKey.(*ecdsaPublicKey); ok {
+		// ECDSA keys use the curve hash by default, other digests can be requested explicitly
+		if algorithm == "" {
+			algorithm = ecKey.Type()
+		}
+		var err error
+		hashFunc, err = ecKey.hash(algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: unsupported signature algorithm %s", algorithm)
+		}
 	} else {
 		// The only supported algorithm for all other key types is the same as the type of the key
 		if algorithm == "" {
@@ -430,6 +625,9 @@ func (s *wrappedSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm
 		switch key := s.pubKey.(type) {
 		case *dsaPublicKey:
 			hashFunc = crypto.SHA1
+		case ed25519PublicKey:
+			// Ed25519 signs the message itself, not a digest
+			hashFunc = 0
 		default:
 			return nil, fmt.Errorf("ssh: unsupported key type %T", key)
 		}
@@ -453,7 +651,7 @@ func (s *wrappedSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm
 	// for ECDSA and DSA, but that's not the encoding expected by SSH, so
 	// re-encode.
 	switch s.pubKey.(type) {
-	case *dsaPublicKey:
+	case *ecdsaPublicKey, *dsaPublicKey:
 		type asn1Signature struct {
 			R, S *big.Int
 		}
@@ -464,6 +662,8 @@ func (s *wrappedSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm
 		}
 
 		switch s.pubKey.(type) {
+		case *ecdsaPublicKey:
+			signature = ssh.Marshal(asn1Sig)
 
 		case *dsaPublicKey:
 			signature = make([]byte, 40)
@@ -512,14 +712,15 @@ func encryptedBlock(block *pem.Block) bool {
 }
 
 // ParseRawPrivateKey returns a private key from a PEM encoded private key. It
-// supports RSA (PKCS#1), PKCS#8, DSA (OpenSSL), and ECDSA private keys.
+// supports RSA (PKCS#1), PKCS#8, DSA (OpenSSL), ECDSA (SEC 1) and OpenSSH
+// private keys.
 func ParseRawPrivateKey(pemBytes []byte) (interface{}, error) {
 	block, _ := pem.Decode(pemBytes)
 	if block == nil {
 		return nil, errors.New("ssh: no key found")
 	}
 
-	if encryptedBlock(block) {
+	if encryptedBlock(block) || block.Type == "ENCRYPTED PRIVATE KEY" {
 		return nil, errors.New("ssh: cannot decode encrypted private keys")
 	}
 
@@ -529,16 +730,21 @@ func ParseRawPrivateKey(pemBytes []byte) (interface{}, error) {
 	// RFC5208 - https://tools.ietf.org/html/rfc5208
 	case "PRIVATE KEY":
 		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
 	case "DSA PRIVATE KEY":
 		return ParseDSAPrivateKey(block.Bytes)
+	case "OPENSSH PRIVATE KEY":
+		return parseOpenSSHPrivateKey(pemBytes, nil)
 	default:
 		return nil, fmt.Errorf("ssh: unsupported key type %q", block.Type)
 	}
 }
 
 // ParseRawPrivateKeyWithPassphrase returns a private key decrypted with
-// passphrase from a PEM encoded private key. If wrong passphrase, return
-// x509.IncorrectPasswordError.
+// passphrase from a PEM encoded private key. It supports legacy PEM encryption
+// (Proc-Type: 4,ENCRYPTED), encrypted PKCS#8 (PBES2) and OpenSSH private keys. If wrong
+// passphrase, return x509.IncorrectPasswordError.
 func ParseRawPrivateKeyWithPassphrase(pemBytes, passPhrase []byte) (interface{}, error) {
 	block, _ := pem.Decode(pemBytes)
 	if block == nil {
@@ -562,13 +768,46 @@ func ParseRawPrivateKeyWithPassphrase(pemBytes, passPhrase []byte) (interface{},
 	switch block.Type {
 	case "RSA PRIVATE KEY":
 		return x509.ParsePKCS1PrivateKey(buf)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(buf)
+	case "ENCRYPTED PRIVATE KEY":
+		der, err := decryptPKCS8PrivateKey(buf, passPhrase)
+		if err != nil {
+			return nil, err
+		}
+		return x509.ParsePKCS8PrivateKey(der)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(buf)
 	case "DSA PRIVATE KEY":
 		return ParseDSAPrivateKey(buf)
+	case "OPENSSH PRIVATE KEY":
+		return parseOpenSSHPrivateKey(pemBytes, passPhrase)
 	default:
 		return nil, fmt.Errorf("ssh: unsupported key type %q", block.Type)
 	}
 }
 
+// parseOpenSSHPrivateKey returns a private key from an openssh-key-v1 PEM
+// encoded private key (as created by ssh-keygen), decrypted with passPhrase
+// if not nil.
+func parseOpenSSHPrivateKey(pemBytes, passPhrase []byte) (interface{}, error) {
+	var key interface{}
+	var err error
+	if passPhrase == nil {
+		key, err = ssh.ParseRawPrivateKey(pemBytes)
+	} else {
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, passPhrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// x/crypto/ssh gives a pointer for Ed25519 keys
+	if edKey, ok := key.(*ed25519.PrivateKey); ok {
+		return *edKey, nil
+	}
+	return key, nil
+}
+
 // ParseDSAPrivateKey returns a DSA private key from its ASN.1 DER encoding, as
 // specified by the OpenSSL DSA man page.
 func ParseDSAPrivateKey(der []byte) (*dsa.PrivateKey, error) {
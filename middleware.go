@@ -6,13 +6,21 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 )
 
 const (
 	ticketKey AuthPubTktContextKey = iota
+	udataKey
 )
 
 type AuthPubTktContextKey int
+
+// ticketReissuer is implemented by AuthPubTkt which can re-issue tickets decrypted with an older passphrase
+type ticketReissuer interface {
+	ReissueTicketInResponse(resp http.ResponseWriter, ticket *Ticket) error
+}
+
 type AuthPubTktHandler struct {
 	auth             AuthPubTkt
 	options          AuthPubTktOptions
@@ -21,6 +29,9 @@ type AuthPubTktHandler struct {
 	showErrorDetails bool
 	statusText       string
 	statusCode       int
+	// bauthKey is swapped when TKTAuthPassthruBasicKeyFile changes
+	bauthKey     *atomic.Pointer[string]
+	bauthWatcher *fileWatcher
 }
 
 func NewAuthPubTktHandler(options AuthPubTktOptions, next http.Handler, handlerOpts ...AuthPubTktHandlerOption) (*AuthPubTktHandler, error) {
@@ -30,6 +41,9 @@ func NewAuthPubTktHandler(options AuthPubTktOptions, next http.Handler, handlerO
 	}
 	if options.TKTAuthCookieName == "" {
 		options.TKTAuthCookieName = "auth_pubtkt"
+		if options.TKTAuthSecret != "" || options.TKTAuthSecretFile != "" {
+			options.TKTAuthCookieName = "auth_tkt"
+		}
 	}
 	if options.TKTAuthBackArgName == "" {
 		options.TKTAuthBackArgName = "back"
@@ -49,15 +63,38 @@ func NewAuthPubTktHandler(options AuthPubTktOptions, next http.Handler, handlerO
 	if options.TKTAuthRefreshURL == "" {
 		options.TKTAuthRefreshURL = options.TKTAuthLoginURL
 	}
+	if options.TKTAuthPassthruBasicKey != "" && options.TKTAuthPassthruBasicKeyFile != "" {
+		return nil, fmt.Errorf("TKTAuthPassthruBasicKey and TKTAuthPassthruBasicKeyFile can't be set at the same time")
+	}
+	if _, _, err = bauthMethod(EncMethod(options.TKTAuthPassthruBasicMethod)); err != nil {
+		return nil, err
+	}
+	if options.TKTAuthPassthruBasicKey != "" {
+		err = CheckBauthKey(options.TKTAuthPassthruBasicKey, EncMethod(options.TKTAuthPassthruBasicMethod))
+		if err != nil {
+			return nil, fmt.Errorf("error with TKTAuthPassthruBasicKey: %s", err.Error())
+		}
+	}
 	handler := &AuthPubTktHandler{
 		options:    options,
 		next:       next,
 		statusText: http.StatusText(http.StatusForbidden),
 		statusCode: http.StatusForbidden,
+		bauthKey:   &atomic.Pointer[string]{},
+	}
+	handler.bauthKey.Store(&options.TKTAuthPassthruBasicKey)
+	if options.TKTAuthPassthruBasicKeyFile != "" {
+		err = handler.reloadBauthKey()
+		if err != nil {
+			return nil, err
+		}
 	}
 	for _, s := range handlerOpts {
 		err = s(handler)
 		if err != nil {
+			// an option may have created the AuthPubTkt
+			// nolint:errcheck
+			handler.Close()
 			return nil, err
 		}
 	}
@@ -68,8 +105,52 @@ func NewAuthPubTktHandler(options AuthPubTktOptions, next http.Handler, handlerO
 			return nil, err
 		}
 	}
+	// files are watched last, the AuthPubTkt is the only thing to close when an error occurs before
+	if options.TKTAuthPassthruBasicKeyFile != "" {
+		handler.bauthWatcher, err = newFileWatcher([]string{options.TKTAuthPassthruBasicKeyFile}, func() {
+			err := handler.reloadBauthKey()
+			if err != nil {
+				ReloadErrorFunc(err)
+			}
+		})
+		if err != nil {
+			// nolint:errcheck
+			handler.Close()
+			return nil, err
+		}
+	}
 	return handler, nil
 }
+
+// reloadBauthKey loads bauth key from TKTAuthPassthruBasicKeyFile
+// previous key is kept if an error occurred
+func (h AuthPubTktHandler) reloadBauthKey() error {
+	bauthKey, err := readSecretFile(h.options.TKTAuthPassthruBasicKeyFile)
+	if err != nil {
+		return fmt.Errorf("error when reading TKTAuthPassthruBasicKeyFile: %s", err.Error())
+	}
+	err = CheckBauthKey(bauthKey, EncMethod(h.options.TKTAuthPassthruBasicMethod))
+	if err != nil {
+		return fmt.Errorf("error with TKTAuthPassthruBasicKeyFile: %s", err.Error())
+	}
+	h.bauthKey.Store(&bauthKey)
+	return nil
+}
+
+// Close stops watching files set in options, if any
+func (h AuthPubTktHandler) Close() error {
+	if h.bauthWatcher != nil {
+		err := h.bauthWatcher.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if h.auth != nil {
+		return h.auth.Close()
+	}
+	return nil
+}
+
 func (h AuthPubTktHandler) forgeRedirect(redirectUrl string, w http.ResponseWriter, req *http.Request) {
 	redirect, _ := url.Parse(redirectUrl)
 	query := redirect.Query()
@@ -94,6 +175,13 @@ func (h AuthPubTktHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			h.writeErr(err, w)
 			return
 		}
+		if reissuer, ok := h.auth.(ticketReissuer); ok && ticket.CipherPasswdIndex > 0 {
+			err = reissuer.ReissueTicketInResponse(w, ticket)
+			if err != nil {
+				h.writeErr(err, w)
+				return
+			}
+		}
 		h.next.ServeHTTP(w, req)
 		return
 	}
@@ -102,7 +190,8 @@ func (h AuthPubTktHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	_, isValidExp := err.(ErrValidationExpired)
 	_, isGraceExp := err.(ErrGracePeriodExpired)
 	_, isNoToken := err.(ErrNoValidToken)
-	if isSigNotValid || isNoTicket {
+	_, isWeakAlgorithm := err.(ErrWeakAlgorithm)
+	if isSigNotValid || isNoTicket || isWeakAlgorithm {
 		h.forgeRedirect(h.options.TKTAuthLoginURL, w, req)
 		return
 	}
@@ -133,11 +222,12 @@ func (h AuthPubTktHandler) WriteBasicAuth(ticket *Ticket, req *http.Request) err
 		req.SetBasicAuth(ticket.Uid, "password")
 		return nil
 	}
-	if h.options.TKTAuthPassthruBasicKey == "" {
+	bauthKey := *h.bauthKey.Load()
+	if bauthKey == "" {
 		req.Header.Set("Authorization", ticket.Bauth)
 		return nil
 	}
-	bauthDecrypted, err := BauthDecrypt(ticket.Bauth, h.options.TKTAuthPassthruBasicKey)
+	bauthDecrypted, err := BauthDecryptWithMethod(ticket.Bauth, bauthKey, EncMethod(h.options.TKTAuthPassthruBasicMethod))
 	if err != nil {
 		return err
 	}
@@ -168,7 +258,9 @@ func TicketRequest(req *http.Request) *Ticket {
 func setTicket(ticket *Ticket, req *http.Request) {
 	ticketCtx := req.Context().Value(ticketKey)
 	if ticketCtx == nil {
-		ctxValueReq := req.WithContext(context.WithValue(req.Context(), ticketKey, ticket))
+		ctx := context.WithValue(req.Context(), ticketKey, ticket)
+		ctx = context.WithValue(ctx, udataKey, newUdataCache())
+		ctxValueReq := req.WithContext(ctx)
 		*req = *ctxValueReq
 		return
 	}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 )
 
 var _ = Describe("Middleware", func() {
@@ -124,6 +125,97 @@ var _ = Describe("Middleware", func() {
 				Expect(req.Header.Get("Authorization")).Should(Equal("mydata"))
 			})
 		})
+		Context("When bauth is encrypted with gcm", func() {
+			It("should decrypt bauth with a 32 bytes key", func() {
+				key := "0123456789ABCDEF0123456789ABCDEF"
+				h, err := NewAuthPubTktHandler(
+					AuthPubTktOptions{
+						TKTAuthPassthruBasicAuth:   true,
+						TKTAuthPassthruBasicKey:    key,
+						TKTAuthPassthruBasicMethod: "gcm",
+						TKTAuthLoginURL:            "fake",
+					},
+					http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+					SetCreateAuthPubTktFunc(funcFakePubTkt),
+				)
+				Expect(err).ToNot(HaveOccurred())
+				cryptedBauth, err := BauthEncryptWithMethod("mydata", key, MethodGcm)
+				Expect(err).ToNot(HaveOccurred())
+				fakePubTkt.VerifyFromRequestReturns(&Ticket{Uid: "user", Bauth: cryptedBauth}, nil)
+				req, _ := http.NewRequest("GET", "http://localhost.com", nil)
+
+				h.ServeHTTP(httptest.NewRecorder(), req)
+
+				Expect(req.Header.Get("Authorization")).Should(Equal("mydata"))
+			})
+			It("should complain at creation when key length doesn't fit the method", func() {
+				_, err := NewAuthPubTktHandler(
+					AuthPubTktOptions{
+						TKTAuthPassthruBasicAuth:   true,
+						TKTAuthPassthruBasicKey:    "AZERTYUIOPQSDFGH",
+						TKTAuthPassthruBasicMethod: "gcm",
+						TKTAuthLoginURL:            "fake",
+					},
+					http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+					SetCreateAuthPubTktFunc(funcFakePubTkt),
+				)
+				Expect(err).To(HaveOccurred())
+
+				_, err = NewAuthPubTktHandler(
+					AuthPubTktOptions{
+						TKTAuthPassthruBasicAuth: true,
+						TKTAuthPassthruBasicKey:  "0123456789ABCDEF0123",
+						TKTAuthLoginURL:          "fake",
+					},
+					http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+					SetCreateAuthPubTktFunc(funcFakePubTkt),
+				)
+				Expect(err).To(HaveOccurred())
+			})
+			It("should accept AES-192 and AES-256 keys with cbc like before", func() {
+				for _, key := range []string{"0123456789ABCDEF01234567", "0123456789ABCDEF0123456789ABCDEF"} {
+					_, err := NewAuthPubTktHandler(
+						AuthPubTktOptions{
+							TKTAuthPassthruBasicAuth: true,
+							TKTAuthPassthruBasicKey:  key,
+							TKTAuthLoginURL:          "fake",
+						},
+						http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+						SetCreateAuthPubTktFunc(funcFakePubTkt),
+					)
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+		})
+		Context("When bauth key is in a file", func() {
+			It("should decrypt bauth with key reloaded from file", func() {
+				keyFile, err := os.CreateTemp("", "bauth-key")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(keyFile.Name())
+				_, err = keyFile.WriteString("0123456789ABCDEF\n")
+				Expect(err).ToNot(HaveOccurred())
+				keyFile.Close()
+
+				h, err := NewAuthPubTktHandler(
+					AuthPubTktOptions{TKTAuthPassthruBasicAuth: true, TKTAuthPassthruBasicKeyFile: keyFile.Name(), TKTAuthLoginURL: "fake"},
+					http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+					SetCreateAuthPubTktFunc(funcFakePubTkt),
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer h.Close()
+
+				cryptedBauth, err := BauthEncrypt("mydata", "AZERTYUIOPQSDFGH")
+				Expect(err).ToNot(HaveOccurred())
+				fakePubTkt.VerifyFromRequestReturns(&Ticket{Uid: "user", Bauth: cryptedBauth}, nil)
+
+				Expect(os.WriteFile(keyFile.Name(), []byte("AZERTYUIOPQSDFGH"), 0600)).To(Succeed())
+				Eventually(func() string {
+					req, _ := http.NewRequest("GET", "http://localhost.com", nil)
+					h.ServeHTTP(httptest.NewRecorder(), req)
+					return req.Header.Get("Authorization")
+				}).Should(Equal("mydata"))
+			})
+		})
 		Context("When ticket is not valid", func() {
 			Context("And error is not recognized", func() {
 				BeforeEach(func() {
@@ -290,6 +382,20 @@ var _ = Describe("Middleware", func() {
 			})
 		})
 	})
+	Context("NewAuthPubTktHandler", func() {
+		It("should close the AuthPubTkt when a handler option fails", func() {
+			_, err := NewAuthPubTktHandler(
+				AuthPubTktOptions{TKTAuthLoginURL: "fake"},
+				http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+				SetCreateAuthPubTktFunc(funcFakePubTkt),
+				func(h *AuthPubTktHandler) error {
+					return errors.New("option error")
+				},
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(fakePubTkt.CloseCallCount()).To(Equal(1))
+		})
+	})
 })
 
 func respToString(resp *http.Response) string {
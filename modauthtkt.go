@@ -0,0 +1,176 @@
+package pubtkt
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// modAuthTktDefaultTimeout is the default lifetime of mod_auth_tkt tickets
+const modAuthTktDefaultTimeout = 2 * time.Hour
+
+// modAuthTkt is the codec of Apache mod_auth_tkt tickets, a ticket is:
+//
+//	digest + hex timestamp (8 chars) + uid + "!" + tokens + "!" + udata
+//
+// ("tokens!" is omitted when there is no token) and is given base64 encoded.
+// The digest is HASH(HASH(ip + timestamp + secret + uid + "\0" + tokens + "\0" + udata) + secret) in hexadecimal,
+// ip and timestamp being 4 bytes each in network byte order.
+type modAuthTkt struct {
+	hash     func() hash.Hash
+	timeout  time.Duration
+	ignoreIP bool
+}
+
+func newModAuthTkt(options AuthPubTktOptions) (*modAuthTkt, error) {
+	m := &modAuthTkt{
+		timeout:  options.TKTAuthTimeout,
+		ignoreIP: options.TKTAuthIgnoreIP,
+	}
+	if m.timeout == 0 {
+		m.timeout = modAuthTktDefaultTimeout
+	}
+	switch strings.ToUpper(options.TKTAuthDigestType) {
+	case "", "MD5":
+		m.hash = md5.New
+	case "SHA256":
+		m.hash = sha256.New
+	case "SHA512":
+		m.hash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported TKTAuthDigestType %s, it can be MD5, SHA256 or SHA512", options.TKTAuthDigestType)
+	}
+	return m, nil
+}
+
+// digestLength gives the length of hexadecimal digests
+func (m modAuthTkt) digestLength() int {
+	return 2 * m.hash().Size()
+}
+
+// parse gives the ticket from a mod_auth_tkt ticket, base64 encoded or not.
+// RawData is set to the ticket without its digest to keep its timestamp.
+func (m modAuthTkt) parse(raw string) (*Ticket, error) {
+	if !strings.Contains(raw, "!") {
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, NewErrSigNotValid(fmt.Errorf("ticket is not a mod_auth_tkt ticket"))
+		}
+		raw = string(decoded)
+	}
+	digestLength := m.digestLength()
+	if len(raw) < digestLength+8 {
+		return nil, NewErrNoSig()
+	}
+	ts, err := strconv.ParseUint(raw[digestLength:digestLength+8], 16, 32)
+	if err != nil {
+		return nil, NewErrSigNotValid(fmt.Errorf("ticket timestamp is not valid"))
+	}
+	parts := strings.SplitN(raw[digestLength+8:], "!", 3)
+	if len(parts) < 2 {
+		return nil, NewErrSigNotValid(fmt.Errorf("ticket is not a mod_auth_tkt ticket"))
+	}
+	ticket := &Ticket{
+		Uid:        parts[0],
+		Udata:      parts[len(parts)-1],
+		Validuntil: time.Unix(int64(ts), 0).Add(m.timeout),
+		Sig:        raw[:digestLength],
+		RawData:    raw[digestLength:],
+	}
+	if len(parts) == 3 && parts[1] != "" {
+		ticket.Tokens = strings.Split(parts[1], ",")
+	}
+	return ticket, nil
+}
+
+// timestamp gives the time the ticket has been created, kept in RawData for a parsed ticket
+func (m modAuthTkt) timestamp(ticket *Ticket) uint32 {
+	if len(ticket.RawData) >= 8 {
+		ts, err := strconv.ParseUint(ticket.RawData[:8], 16, 32)
+		if err == nil {
+			return uint32(ts)
+		}
+	}
+	return uint32(ticket.Validuntil.Add(-m.timeout).Unix())
+}
+
+// String gives the signed ticket base64 encoded
+func (m modAuthTkt) String(ticket *Ticket) string {
+	data := fmt.Sprintf("%s%08x%s!", ticket.Sig, m.timestamp(ticket), ticket.Uid)
+	if len(ticket.Tokens) > 0 {
+		data += strings.Join(ticket.Tokens, ",") + "!"
+	}
+	data += ticket.Udata
+	return base64.StdEncoding.EncodeToString([]byte(data))
+}
+
+// sign sets the digest of the ticket, bound to the ip in Cip unless TKTAuthIgnoreIP is set.
+// Validuntil is set from TKTAuthTimeout if not set.
+func (m modAuthTkt) sign(secret string, ticket *Ticket) error {
+	if strings.Contains(ticket.Uid, "!") {
+		return fmt.Errorf("uid of mod_auth_tkt tickets can't contain '!'")
+	}
+	for _, token := range ticket.Tokens {
+		if strings.ContainsAny(token, "!,") {
+			return fmt.Errorf("tokens of mod_auth_tkt tickets can't contain '!' or ','")
+		}
+	}
+	if len(ticket.Extensions) > 0 {
+		return fmt.Errorf("mod_auth_tkt tickets can't have extension fields")
+	}
+	if ticket.Validuntil.IsZero() {
+		ticket.Validuntil = TimeNowFunc().Add(m.timeout)
+	}
+	if !m.ignoreIP && ticket.Cip == "" {
+		return fmt.Errorf("cip must be set to sign mod_auth_tkt tickets when TKTAuthIgnoreIP is not set")
+	}
+	digest, err := m.digest(secret, ticket, ticket.Cip)
+	if err != nil {
+		return err
+	}
+	ticket.Sig = digest
+	return nil
+}
+
+// verify checks the digest of the ticket for the client ip
+func (m modAuthTkt) verify(secret string, ticket *Ticket, clientIp string) error {
+	digest, err := m.digest(secret, ticket, clientIp)
+	if err != nil {
+		return NewErrSigNotValid(err)
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.ToLower(ticket.Sig)), []byte(digest)) != 1 {
+		return NewErrSigNotValid()
+	}
+	return nil
+}
+
+func (m modAuthTkt) digest(secret string, ticket *Ticket, ip string) (string, error) {
+	ipts := make([]byte, 8)
+	if !m.ignoreIP {
+		ipv4 := net.ParseIP(ip).To4()
+		if ipv4 == nil {
+			return "", fmt.Errorf("mod_auth_tkt tickets can only be bound to an IPv4 address")
+		}
+		copy(ipts, ipv4)
+	}
+	binary.BigEndian.PutUint32(ipts[4:], m.timestamp(ticket))
+
+	h := m.hash()
+	h.Write(ipts)
+	h.Write([]byte(secret + ticket.Uid + "\x00" + strings.Join(ticket.Tokens, ",") + "\x00" + ticket.Udata))
+	digest0 := hex.EncodeToString(h.Sum(nil))
+
+	h = m.hash()
+	h.Write([]byte(digest0 + secret))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,146 @@
+package pubtkt_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/orange-cloudfoundry/go-auth-pubtkt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ModAuthTkt", func() {
+	secret := "fee-fi-fo-fum"
+	created := time.Unix(1600000000, 0)
+	// tickets created by mod_auth_tkt for uid myuser, tokens token1,token2 and udata mydata
+	// at 1600000000 from 127.0.0.1
+	md5Ticket := "MDNlNzg3MGFmYzIwYWEwNTY2MDkwYTQ2NDM3OGZmNGM1ZjVlMTAwMG15dXNlciF0b2tlbjEsdG9rZW4yIW15ZGF0YQ=="
+	sha256Ticket := "137b9307c3599101942e239ae4facf997cd10630113cab8e14b69d0fd7647b25" +
+		"5f5e1000myuser!token1,token2!mydata"
+	var options AuthPubTktOptions
+
+	BeforeEach(func() {
+		TimeNowFunc = func() time.Time {
+			return created.Add(time.Hour)
+		}
+		options = AuthPubTktOptions{
+			TKTAuthSecret: secret,
+			TKTAuthHeader: []string{"cookie"},
+		}
+	})
+	It("should parse and verify mod_auth_tkt tickets", func() {
+		auth, err := NewAuthPubTkt(options)
+		Expect(err).ToNot(HaveOccurred())
+
+		ticket, err := auth.RawToTicket(md5Ticket)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ticket.Uid).To(Equal("myuser"))
+		Expect(ticket.Tokens).To(Equal([]string{"token1", "token2"}))
+		Expect(ticket.Udata).To(Equal("mydata"))
+		Expect(ticket.Validuntil).To(Equal(created.Add(2 * time.Hour)))
+		Expect(auth.VerifyTicket(ticket, "127.0.0.1")).To(Succeed())
+
+		err = auth.VerifyTicket(ticket, "127.0.0.2")
+		Expect(err).To(BeAssignableToTypeOf(ErrSigNotValid("")))
+
+		TimeNowFunc = func() time.Time {
+			return created.Add(3 * time.Hour)
+		}
+		err = auth.VerifyTicket(ticket, "127.0.0.1")
+		Expect(err).To(BeAssignableToTypeOf(ErrValidationExpired("")))
+	})
+	It("should parse and verify mod_auth_tkt tickets with sha256 digest", func() {
+		options.TKTAuthDigestType = "SHA256"
+		auth, err := NewAuthPubTkt(options)
+		Expect(err).ToNot(HaveOccurred())
+
+		ticket, err := auth.RawToTicket(sha256Ticket)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(auth.VerifyTicket(ticket, "127.0.0.1")).To(Succeed())
+
+		options.TKTAuthSecret = "other secret"
+		otherAuth, err := NewAuthPubTkt(options)
+		Expect(err).ToNot(HaveOccurred())
+		err = otherAuth.VerifyTicket(ticket, "127.0.0.1")
+		Expect(err).To(BeAssignableToTypeOf(ErrSigNotValid("")))
+	})
+	It("should create tickets like mod_auth_tkt", func() {
+		auth, err := NewAuthPubTkt(options)
+		Expect(err).ToNot(HaveOccurred())
+
+		raw, err := auth.TicketToRaw(&Ticket{
+			Uid:        "myuser",
+			Cip:        "127.0.0.1",
+			Tokens:     []string{"token1", "token2"},
+			Udata:      "mydata",
+			Validuntil: created.Add(2 * time.Hour),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(raw).To(Equal(md5Ticket))
+
+		options.TKTAuthIgnoreIP = true
+		auth, err = NewAuthPubTkt(options)
+		Expect(err).ToNot(HaveOccurred())
+		TimeNowFunc = func() time.Time {
+			return created
+		}
+		raw, err = auth.TicketToRaw(&Ticket{Uid: "myuser"})
+		Expect(err).ToNot(HaveOccurred())
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(decoded)).To(Equal("e1c34912afc0e3e9cb60f3dd807ab7ce5f5e1000myuser!"))
+
+		ticket, err := auth.RawToTicket(raw)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(auth.VerifyTicket(ticket, "10.0.0.1")).To(Succeed())
+	})
+	It("should refuse tickets which are not mod_auth_tkt tickets", func() {
+		auth, err := NewAuthPubTkt(options)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = auth.RawToTicket("uid=myuser;validuntil=1600003600;sig=c2ln")
+		Expect(err).To(HaveOccurred())
+		_, err = auth.RawToTicket("not base64")
+		Expect(err).To(HaveOccurred())
+		_, err = auth.RawToTicket("03e7870afc20aa0566090a464378ff4c5f5e1000myuser")
+		Expect(err).To(HaveOccurred())
+	})
+	It("should complain at creation when options are not consistent", func() {
+		options.TKTAuthDigestType = "SHA1"
+		_, err := NewAuthPubTkt(options)
+		Expect(err).To(HaveOccurred())
+
+		options.TKTAuthDigestType = ""
+		options.TKTAuthPublicKey = "a public key"
+		_, err = NewAuthPubTkt(options)
+		Expect(err).To(HaveOccurred())
+
+		options.TKTAuthPublicKey = ""
+		options.TKTCypherTicketsWithPasswd = "mypassphrase"
+		options.TKTCypherTicketsAcceptPlain = true
+		_, err = NewAuthPubTkt(options)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should authenticate requests with a mod_auth_tkt cookie in the middleware", func() {
+		options.TKTAuthLoginURL = "http://login.example.com"
+		options.TKTAuthToken = []string{"token2"}
+		var ticket *Ticket
+		h, err := NewAuthPubTktHandler(options, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ticket = TicketRequest(req)
+		}))
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest("GET", "http://localhost.com", nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		req.AddCookie(&http.Cookie{Name: "auth_tkt", Value: md5Ticket})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(ticket).ToNot(BeNil())
+		Expect(ticket.Uid).To(Equal("myuser"))
+	})
+})
@@ -7,22 +7,102 @@ import (
 )
 
 type AuthPubTktOptions struct {
-	// A DSA or RSA public key in PEM format
+	// A DSA, RSA, ECDSA (P-256, P-384 or P-521) or Ed25519 public key in PEM format or as an OpenSSH authorized_keys line
 	// This public key will be used to verify ticket signatures
+	// It can also be a X.509 certificate in PEM format, followed by its intermediate certificates if any
+	// The certificate chain, validity window and key usage are then checked against TKTAuthCACerts before using its key
+	// (extended key usage is only checked if TKTAuthCertExtKeyUsages is set)
 	TKTAuthPublicKey string
-	// A DSA or RSA private key in PEM format
+	// Path to a file containing TKTAuthPublicKey, can't be used with TKTAuthPublicKey
+	// The file is watched and the key reloaded when it changes
+	TKTAuthPublicKeyFile string
+	// A list of public keys also trusted to verify ticket signatures (in addition to TKTAuthPublicKey if set)
+	// A ticket is accepted if it is signed by any of the active keys, this allows rotating keys without a flag day
+	// If the ticket has a kid field, only the key with this id is used
+	TKTAuthPublicKeys []AuthPubTktKey
+	// CA certificates in PEM format trusted to issue the certificates given as public keys
+	// Required when TKTAuthPublicKey or a key from TKTAuthPublicKeys is a X.509 certificate
+	TKTAuthCACerts string
+	// Extended key usages accepted for the certificates given as public keys, one of them must be allowed by the chain
+	// Names are the ones used by openssl: serverAuth, clientAuth, codeSigning, emailProtection, timeStamping, OCSPSigning or any
+	// Default to any: the extended key usage of certificates is not checked
+	TKTAuthCertExtKeyUsages []string
+	// A DSA, RSA, ECDSA (P-256, P-384 or P-521) or Ed25519 (PKCS#8 or OpenSSH) private key in PEM format
+	// OpenSSH private keys are the ones created by ssh-keygen
 	// This private key will be used to create ticket signature
 	// This is optional, only needed if you want sign ticket
 	TKTAuthPrivateKey string
+	// Path to a file containing TKTAuthPrivateKey, can't be used with TKTAuthPrivateKey
+	// The file is watched and the key reloaded when it changes
+	TKTAuthPrivateKeyFile string
+	// Passphrase to decrypt TKTAuthPrivateKey when it is encrypted
+	// Legacy PEM encryption (Proc-Type: 4,ENCRYPTED), encrypted PKCS#8 (ENCRYPTED PRIVATE KEY, PBES2 with PBKDF2) and encrypted OpenSSH keys are supported
+	TKTAuthPrivateKeyPassphrase string
+	// Path to a file containing TKTAuthPrivateKeyPassphrase, can't be used with TKTAuthPrivateKeyPassphrase
+	// The file is watched and the passphrase reloaded when it changes
+	TKTAuthPrivateKeyPassphraseFile string
+	// A signer used to create ticket signatures in place of TKTAuthPrivateKey
+	// This lets the private key stay outside the process (e.g. in a HSM or a signing daemon)
+	// Any crypto.Signer can be used by wrapping it with NewSignerFromSigner
+	TKTAuthSigner Signer
+	// Path to the unix socket of a ssh-agent (e.g. the value of SSH_AUTH_SOCK) to create ticket signatures with
+	// This lets the private key stay in the agent instead of in a config file
+	// The agent only signs with SSH digests: SHA1, SHA256 or SHA512 for RSA keys, the digest matching the curve for ECDSA keys
+	TKTAuthAgentSocket string
+	// Key from the ssh-agent to create ticket signatures with, as a SHA256 fingerprint (e.g. SHA256:...) or a key comment
+	// If not set, the agent must hold only one key
+	TKTAuthAgentKey string
+	// Key id to set in the kid field of tickets signed with TKTAuthPrivateKey, TKTAuthSigner or TKTAuthAgentSocket
+	// This is optional, it lets verifiers pick directly the key from their TKTAuthPublicKeys
+	TKTAuthPrivateKeyID string
+	// Shared secret of Apache mod_auth_tkt, if set tickets are mod_auth_tkt tickets authenticated with a digest
+	// of this secret (and of the client ip) instead of mod_auth_pubtkt tickets signed with a private key
+	// Public and private keys can't be used then
+	TKTAuthSecret string
+	// Path to a file containing TKTAuthSecret, can't be used with TKTAuthSecret
+	// The file is watched and the secret reloaded when it changes
+	TKTAuthSecretFile string
+	// Digest of mod_auth_tkt tickets, it can be MD5, SHA256 or SHA512
+	// Default: MD5
+	TKTAuthDigestType string
+	// Lifetime of mod_auth_tkt tickets from the time they have been created
+	// Default: 2h (mod_auth_tkt default)
+	TKTAuthTimeout time.Duration
+	// If true, the client ip is not part of mod_auth_tkt digests
+	// Default: false
+	TKTAuthIgnoreIP bool
+	// If true, tickets are refused with ErrMalformedTicket when they have repeated fields, empty keys, fields without '=',
+	// fields after sig or malformed timestamps (see ParseTicketStrict)
+	// Default: false, tickets are parsed leniently like mod_auth_pubtkt does, the last value of a repeated field is kept
+	TKTAuthStrictParsing bool
+	// If true, values of tickets are escaped with percent-encoding when tickets are created and unescaped when they are parsed
+	// (see EscapeTicketValue), they can contain ';', '=' or ',' (e.g. json in udata). It can't be used with TKTAuthSecret.
+	// Default: false, values are written as they are like mod_auth_pubtkt does,
+	// values which would not be parsed back as they are (e.g. an uid with ';') are refused with ErrUnsafeTicketValue
+	TKTAuthEscapeValues bool
 	// Domain to use when placing ticket as a cookie
 	// E.G.: .example.com
 	TKTAuthDomain string
 	// Set to true if all your website use https and ticket is placed in a cookie
 	TKTAuthSecureCookie bool
-	// String indicating what digest algorithm to use when verifying ticket signatures
+	// String indicating what digest algorithm to use when verifying and creating ticket signatures
 	// Valid values are SHA1, DSS1, SHA224, SHA256, SHA384, and SHA512
+	// Only DSS1 (or SHA1) can be used to create signatures with a DSA private key
 	// If not specified, the old defaults of SHA1 (for an RSA public key) or DSS1 (for a DSA public key) will be used.
+	// For an ECDSA public key, the default is the digest matching the key curve (SHA256 for P-256, SHA384 for P-384, SHA512 for P-521).
+	// Ed25519 signs the ticket data directly, this option doesn't apply to it.
 	TKTAuthDigest string
+	// Key types allowed to create and verify ticket signatures, any of RSA, DSA, ECDSA and ED25519
+	// Signatures made with other key types are rejected with an ErrWeakAlgorithm
+	// If not set, all key types are allowed. E.g. use []string{"RSA", "ECDSA", "ED25519"} to turn off DSA
+	TKTAuthAllowedKeyTypes []string
+	// Minimum size in bits of RSA keys allowed to create and verify ticket signatures (e.g. 2048)
+	// Signatures made with smaller keys are rejected with an ErrWeakAlgorithm
+	TKTAuthMinRSAKeySize int
+	// Digests allowed to create and verify ticket signatures, any of SHA1 (or DSS1), SHA224, SHA256, SHA384 and SHA512
+	// Signatures made with other digests are rejected with an ErrWeakAlgorithm, Ed25519 signatures are not affected
+	// If not set, all digests are allowed. E.g. use []string{"SHA256", "SHA384", "SHA512"} to turn off SHA1
+	TKTAuthAllowedDigests []string
 	// URL that users without a valid ticket will be redirected to
 	// The originally requested URL will be appended as a GET parameter (normally named "back", but can be changed with TKTAuthBackArgName)
 	TKTAuthLoginURL string
@@ -46,7 +126,7 @@ type AuthPubTktOptions struct {
 	// Default: Cookie
 	TKTAuthHeader []string
 	// Name of the authentication cookie to use
-	// Default: auth_pubtkt
+	// Default: auth_pubtkt (auth_tkt with TKTAuthSecret)
 	TKTAuthCookieName string
 	// Name of the GET argument with the originally requested URL (when redirecting to the login page)
 	// Default: back
@@ -66,12 +146,52 @@ type AuthPubTktOptions struct {
 	// Default: false
 	TKTAuthPassthruBasicAuth bool
 	// if set, the bauth value will be decrypted using the given key before it is added to the Authorization header.
-	// length must be exactly 16 characters (AES 128)
+	// length must be 16 characters with cbc method (AES 128, 24 or 32 characters are also accepted for AES 192 or AES 256)
+	// or 32 characters with gcm method (AES 256)
 	TKTAuthPassthruBasicKey string
+	// Path to a file containing TKTAuthPassthruBasicKey, can't be used with TKTAuthPassthruBasicKey
+	// The file is watched and the key reloaded when it changes
+	TKTAuthPassthruBasicKeyFile string
+	// Method used to encrypt bauth values with TKTAuthPassthruBasicKey, it can be either:
+	// cbc: AES-128-CBC as mod_auth_pubtkt does, without integrity check
+	// gcm: AES-256-GCM, authenticated encryption (see BauthEncryptWithMethod)
+	// Default: cbc
+	TKTAuthPassthruBasicMethod string
 	// If set it will crypt/encrypt the cookie with this passphrase (not a key but a passphrase like in openssl)
 	TKTCypherTicketsWithPasswd string
-	// Method of encryption under aes, it can be either cbc or ecb
+	// Path to a file containing TKTCypherTicketsWithPasswd, can't be used with TKTCypherTicketsWithPasswd
+	// The file is watched and the passphrase reloaded when it changes
+	TKTCypherTicketsWithPasswdFile string
+	// An ordered list of passphrases also used to decrypt tickets (after TKTCypherTicketsWithPasswd if set)
+	// Tickets are always encrypted with the first passphrase, others are only tried for decryption, this allows rotating
+	// the passphrase without logging out everyone: tickets decrypted with an older passphrase are re-issued by AuthPubTktHandler
+	// with the first one
+	TKTCypherTicketsWithPasswds []string
+	// Method of encryption, it can be either cbc or ecb (AES-256 like openssl enc, without integrity check)
+	// or gcm (AES-256-GCM) or chacha20-poly1305 for authenticated encryption
+	// With gcm and chacha20-poly1305, the key is derived from TKTCypherTicketsWithPasswd with HKDF-SHA256, which doesn't slow down
+	// brute force: TKTCypherTicketsWithPasswd must be a long random secret
 	TKTCypherTicketsMethod string
+	// Method (cbc or ecb) of tickets encrypted before TKTCypherTicketsMethod was set to gcm or chacha20-poly1305
+	// These tickets are still accepted to allow a migration
+	// Default: cbc
+	TKTCypherTicketsLegacyMethod string
+	// Digest used to derive the key from TKTCypherTicketsWithPasswd with cbc and ecb methods (like openssl enc -md option)
+	// It can be md5, sha1, sha224, sha256, sha384 or sha512
+	// Default: md5 (openssl < 1.1 default) or sha256 when TKTCypherTicketsPBKDF2Iter is set (openssl >= 1.1 default)
+	TKTCypherTicketsDigest string
+	// If set, the key is derived from TKTCypherTicketsWithPasswd with PBKDF2 and this iteration count with cbc and ecb methods
+	// (like openssl enc -pbkdf2 -iter options, openssl default iteration count with -pbkdf2 is 10000)
+	TKTCypherTicketsPBKDF2Iter int
+	// Transition mode to roll out ticket encryption: plain tickets are accepted in addition to encrypted ones
+	// The format of a ticket is detected (see DetectTicketFormat) and given in Ticket.Format
+	// It can't be used with TKTAuthSecret, plain mod_auth_tkt tickets can't be told apart from encrypted ones
+	// Default: false, only encrypted tickets are accepted when a passphrase is set
+	TKTCypherTicketsAcceptPlain bool
+	// If true, tickets are created in plain even if a passphrase is set, it requires TKTCypherTicketsAcceptPlain
+	// Issuers should keep it until every verifier sharing the cookie has a passphrase and TKTCypherTicketsAcceptPlain set
+	// Default: false
+	TKTCypherTicketsIssuePlain bool
 	// If true it will check if ip which created the token is the correct ip who use it
 	// Default: false
 	TKTCheckIpEnabled bool
@@ -79,31 +199,72 @@ type AuthPubTktOptions struct {
 	// default: false
 	TKTCheckXForwardedIp bool
 }
+
+// AuthPubTktKey is a public key trusted to verify ticket signatures
+type AuthPubTktKey struct {
+	// A DSA, RSA, ECDSA or Ed25519 public key in PEM format or as an OpenSSH authorized_keys line
+	// It can also be a X.509 certificate, see TKTAuthPublicKey
+	PublicKey string
+	// Id of the key, matched against the kid field of tickets
+	// If not set, the SHA256 fingerprint of the key is used (see FingerprintSHA256)
+	KeyID string
+	// The key is not trusted anymore after this date
+	// If not set, the key never expires
+	NotAfter time.Time
+}
+
 type Ticket struct {
-	Uid         string    `mapstructure:"uid"`
-	Cip         string    `mapstructure:"cip"`
-	Bauth       string    `mapstructure:"bauth"`
-	Validuntil  time.Time `mapstructure:"validuntil"`
-	Graceperiod time.Time `mapstructure:"graceperiod"`
-	Tokens      []string  `mapstructure:"tokens"`
-	Udata       string    `mapstructure:"udata"`
-	Sig         string    `mapstructure:"sig"`
-	RawData     string    `mapstructure:"-"`
+	Uid         string
+	Cip         string
+	Bauth       string
+	Validuntil  time.Time
+	Graceperiod time.Time
+	Tokens      []string
+	Udata       string
+	Kid         string
+	// Extensions are the fields not known by this package (e.g.: multifactor, iat), in their order in the ticket
+	// They are signed after the known fields
+	Extensions TicketFields
+	Sig        string
+	RawData    string
+	// CipherPasswdIndex is the index of the passphrase which decrypted the ticket,
+	// in TKTCypherTicketsWithPasswd followed by TKTCypherTicketsWithPasswds.
+	// It is 0 when the ticket has been decrypted with the current passphrase or is not encrypted.
+	CipherPasswdIndex int
+	// Format is the format the ticket has been found in, it is only set when TKTCypherTicketsAcceptPlain is set
+	Format TicketFormat
 }
 
+// DataString gives the signed part of the ticket, values are written as they are like mod_auth_pubtkt does
 func (t Ticket) DataString() string {
+	return t.dataString(false)
+}
+
+// EscapedDataString gives the signed part of the ticket with its values escaped (see EscapeTicketValue),
+// as done when TKTAuthEscapeValues is set
+func (t Ticket) EscapedDataString() string {
+	return t.dataString(true)
+}
+
+func (t Ticket) dataString(escape bool) string {
 	if t.RawData != "" {
 		return t.RawData
 	}
+	value := func(v string) string {
+		if escape {
+			return EscapeTicketValue(v)
+		}
+		return v
+	}
 	data := make([]string, 0)
 	if t.Uid != "" {
-		data = append(data, fmt.Sprintf("%s=%s", "uid", t.Uid))
+		data = append(data, fmt.Sprintf("%s=%s", "uid", value(t.Uid)))
 	}
 	if t.Cip != "" {
-		data = append(data, fmt.Sprintf("%s=%s", "cip", t.Cip))
+		data = append(data, fmt.Sprintf("%s=%s", "cip", value(t.Cip)))
 	}
 	if t.Bauth != "" {
-		data = append(data, fmt.Sprintf("%s=%s", "bauth", t.Bauth))
+		data = append(data, fmt.Sprintf("%s=%s", "bauth", value(t.Bauth)))
 	}
 	if !t.Validuntil.IsZero() {
 		data = append(data, fmt.Sprintf("%s=%d", "validuntil", t.Validuntil.Unix()))
@@ -112,17 +273,114 @@ func (t Ticket) DataString() string {
 		data = append(data, fmt.Sprintf("%s=%d", "graceperiod", t.Graceperiod.Unix()))
 	}
 	if len(t.Tokens) != 0 {
-		data = append(data, fmt.Sprintf("%s=%s", "tokens", strings.Join(t.Tokens, ",")))
+		tokens := make([]string, len(t.Tokens))
+		for i, token := range t.Tokens {
+			tokens[i] = value(token)
+		}
+		data = append(data, fmt.Sprintf("%s=%s", "tokens", strings.Join(tokens, ",")))
 	}
 	if t.Udata != "" {
-		data = append(data, fmt.Sprintf("%s=%s", "udata", t.Udata))
+		data = append(data, fmt.Sprintf("%s=%s", "udata", value(t.Udata)))
+	}
+	if t.Kid != "" {
+		data = append(data, fmt.Sprintf("%s=%s", "kid", value(t.Kid)))
+	}
+	for _, field := range t.Extensions {
+		data = append(data, fmt.Sprintf("%s=%s", field.Key, value(field.Value)))
 	}
 	return strings.Join(data, ";")
 }
+
 func (t Ticket) String() string {
-	data := t.DataString()
+	return t.withSig(t.DataString())
+}
+
+// EscapedString gives the ticket with its values escaped (see EscapedDataString)
+func (t Ticket) EscapedString() string {
+	return t.withSig(t.EscapedDataString())
+}
+
+func (t Ticket) withSig(data string) string {
 	if t.Sig != "" {
 		data += fmt.Sprintf(";%s=%s", "sig", t.Sig)
 	}
 	return data
 }
+
+// checkValues ensures that values are parsed back as they are when they are written without escaping,
+// it gives ErrUnsafeTicketValue for the first value which can't be written as it is
+func (t Ticket) checkValues() error {
+	fields := TicketFields{{"uid", t.Uid}, {"cip", t.Cip}, {"bauth", t.Bauth}, {"udata", t.Udata}, {"kid", t.Kid}}
+	for _, token := range t.Tokens {
+		if unsafeTicketValue(token, ";,") {
+			return NewErrUnsafeTicketValue("tokens")
+		}
+	}
+	for _, field := range append(fields, t.Extensions...) {
+		if unsafeTicketValue(field.Value, ";") {
+			return NewErrUnsafeTicketValue(field.Key)
+		}
+	}
+	return nil
+}
+
+// TicketField is an extension field of a ticket
+type TicketField struct {
+	Key   string
+	Value string
+}
+
+// TicketFields are extension fields of a ticket, in their order in the ticket
+type TicketFields []TicketField
+
+// Get gives the value of the field with the given key
+func (f TicketFields) Get(key string) (string, bool) {
+	for _, field := range f {
+		if field.Key == key {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set sets the value of the field with the given key, the field is added at the end if it doesn't exist
+func (f *TicketFields) Set(key, value string) {
+	for i, field := range *f {
+		if field.Key == key {
+			(*f)[i].Value = value
+			return
+		}
+	}
+	*f = append(*f, TicketField{Key: key, Value: value})
+}
+
+// Del removes the field with the given key
+func (f *TicketFields) Del(key string) {
+	for i, field := range *f {
+		if field.Key == key {
+			*f = append((*f)[:i], (*f)[i+1:]...)
+			return
+		}
+	}
+}
+
+// checkKeys ensures that fields are parsed back as extension fields when they are in a ticket
+func (f TicketFields) checkKeys() error {
+	for i, field := range f {
+		if field.Key == "" || strings.ContainsAny(field.Key, ";=") || strings.TrimSpace(field.Key) != field.Key {
+			return fmt.Errorf("extension field key %q is not valid", field.Key)
+		}
+		if isKnownTicketField(field.Key) {
+			return fmt.Errorf("extension field key %q is a known ticket field", field.Key)
+		}
+		if _, exists := f[:i].Get(field.Key); exists {
+			return fmt.Errorf("extension field key %q is repeated", field.Key)
+		}
+	}
+	return nil
+}
+
+// isKnownTicketField tells if the key is the one of a field of Ticket
+func isKnownTicketField(key string) bool {
+	return knownFieldBit(strings.ToLower(key)) != 0
+}
@@ -0,0 +1,326 @@
+package pubtkt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// OpenSSLCipher is a cipher of openssl enc usable with streams
+type OpenSSLCipher string
+
+// Ciphers usable with streams, named like openssl enc ciphers
+const (
+	CipherAES128CBC OpenSSLCipher = "aes-128-cbc"
+	CipherAES192CBC OpenSSLCipher = "aes-192-cbc"
+	CipherAES256CBC OpenSSLCipher = "aes-256-cbc"
+	CipherAES128CTR OpenSSLCipher = "aes-128-ctr"
+	CipherAES192CTR OpenSSLCipher = "aes-192-ctr"
+	CipherAES256CTR OpenSSLCipher = "aes-256-ctr"
+)
+
+// base64LineLength is the length of lines written by openssl enc -a
+const base64LineLength = 64
+
+// OpenSSLStreamOptions are the options of streams encrypted like openssl enc
+type OpenSSLStreamOptions struct {
+	// Cipher used to encrypt the stream
+	// Default: aes-256-cbc
+	Cipher OpenSSLCipher
+	// If true, the encrypted stream is base64 encoded like with openssl enc -a option
+	// Lines of 64 characters are written, lines are accepted with any length when decrypting
+	Base64 bool
+}
+
+// cipherParams gives the key length of the cipher and if it is in CTR mode
+func (opts OpenSSLStreamOptions) cipherParams() (int, bool, error) {
+	switch OpenSSLCipher(strings.ToLower(string(opts.Cipher))) {
+	case CipherAES128CBC:
+		return 16, false, nil
+	case CipherAES192CBC:
+		return 24, false, nil
+	case "", CipherAES256CBC:
+		return 32, false, nil
+	case CipherAES128CTR:
+		return 16, true, nil
+	case CipherAES192CTR:
+		return 24, true, nil
+	case CipherAES256CTR:
+		return 32, true, nil
+	}
+	return 0, false, fmt.Errorf("unsupported cipher %s", opts.Cipher)
+}
+
+// EncryptStream encrypts src to dst like openssl enc does, with a salt and the key derivation of OpenSSL
+func (o OpenSSL) EncryptStream(dst io.Writer, src io.Reader, passphrase string, opts OpenSSLStreamOptions) error {
+	w, err := o.NewEncryptWriter(dst, passphrase, opts)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// DecryptStream decrypts to dst a stream encrypted with openssl enc (or EncryptStream) from src
+func (o OpenSSL) DecryptStream(dst io.Writer, src io.Reader, passphrase string, opts OpenSSLStreamOptions) error {
+	r, err := o.NewDecryptReader(src, passphrase, opts)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, r)
+	return err
+}
+
+// NewEncryptWriter gives a writer encrypting to dst like openssl enc does,
+// it must be closed to write the last block (and the end of the base64 encoding).
+// dst is not closed.
+func (o OpenSSL) NewEncryptWriter(dst io.Writer, passphrase string, opts OpenSSLStreamOptions) (io.WriteCloser, error) {
+	keyLen, isCtr, err := opts.cipherParams()
+	if err != nil {
+		return nil, err
+	}
+	salt, err := o.GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := o.deriveOpenSSLCreds([]byte(passphrase), salt, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(creds.key)
+	if err != nil {
+		return nil, err
+	}
+
+	var armor io.WriteCloser
+	if opts.Base64 {
+		lines := &lineWriter{w: dst, lineLength: base64LineLength}
+		armor = &multiCloser{
+			WriteCloser: base64.NewEncoder(base64.StdEncoding, lines),
+			next:        lines,
+		}
+		dst = armor
+	}
+	_, err = dst.Write(append([]byte(o.openSSLSaltHeader), salt...))
+	if err != nil {
+		return nil, err
+	}
+	if isCtr {
+		return &ctrEncryptWriter{
+			StreamWriter: cipher.StreamWriter{S: cipher.NewCTR(block, creds.iv), W: dst},
+			armor:        armor,
+		}, nil
+	}
+	return &cbcEncryptWriter{
+		dst:   dst,
+		mode:  cipher.NewCBCEncrypter(block, creds.iv),
+		armor: armor,
+	}, nil
+}
+
+// NewDecryptReader gives a reader decrypting a stream encrypted with openssl enc (or NewEncryptWriter) from src.
+// The stream must have been encrypted with a salt (openssl enc default).
+// With CBC, a wrong passphrase is detected (most of the time) from the padding at the end of the stream.
+// With CTR, nothing tells that the passphrase is wrong.
+func (o OpenSSL) NewDecryptReader(src io.Reader, passphrase string, opts OpenSSLStreamOptions) (io.Reader, error) {
+	keyLen, isCtr, err := opts.cipherParams()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Base64 {
+		src = base64.NewDecoder(base64.StdEncoding, src)
+	}
+	saltHeader := make([]byte, aes.BlockSize)
+	_, err = io.ReadFull(src, saltHeader)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading salt: %s", err.Error())
+	}
+	if string(saltHeader[:8]) != o.openSSLSaltHeader {
+		return nil, fmt.Errorf("stream doesn't start with %s header", o.openSSLSaltHeader)
+	}
+	creds, err := o.deriveOpenSSLCreds([]byte(passphrase), saltHeader[8:], keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(creds.key)
+	if err != nil {
+		return nil, err
+	}
+	if isCtr {
+		return cipher.StreamReader{S: cipher.NewCTR(block, creds.iv), R: src}, nil
+	}
+	return &cbcDecryptReader{
+		src:  src,
+		mode: cipher.NewCBCDecrypter(block, creds.iv),
+		buf:  make([]byte, 32*aes.BlockSize),
+	}, nil
+}
+
+// cbcEncryptWriter encrypts whole blocks as they come, the remaining data is padded on Close
+type cbcEncryptWriter struct {
+	dst   io.Writer
+	mode  cipher.BlockMode
+	armor io.Closer
+	// pending is the data not encrypted yet, less than a block
+	pending []byte
+}
+
+func (w *cbcEncryptWriter) Write(p []byte) (int, error) {
+	data := append(w.pending, p...)
+	full := len(data) - len(data)%w.mode.BlockSize()
+	if full > 0 {
+		encData := make([]byte, full)
+		w.mode.CryptBlocks(encData, data[:full])
+		_, err := w.dst.Write(encData)
+		if err != nil {
+			return 0, err
+		}
+	}
+	w.pending = append([]byte{}, data[full:]...)
+	return len(p), nil
+}
+
+func (w *cbcEncryptWriter) Close() error {
+	padded, err := pkcs7Pad(w.pending, w.mode.BlockSize())
+	if err != nil {
+		return err
+	}
+	w.pending = nil
+	w.mode.CryptBlocks(padded, padded)
+	_, err = w.dst.Write(padded)
+	if err != nil {
+		return err
+	}
+	if w.armor != nil {
+		return w.armor.Close()
+	}
+	return nil
+}
+
+type ctrEncryptWriter struct {
+	cipher.StreamWriter
+	armor io.Closer
+}
+
+func (w *ctrEncryptWriter) Close() error {
+	if w.armor != nil {
+		return w.armor.Close()
+	}
+	return nil
+}
+
+// cbcDecryptReader decrypts whole blocks as they come, the last block is held back
+// until the end of the stream to remove its padding
+type cbcDecryptReader struct {
+	src  io.Reader
+	mode cipher.BlockMode
+	buf  []byte
+	// pending is the encrypted data not decrypted yet, less than a block
+	pending []byte
+	// out is the decrypted data ready to be read
+	out []byte
+	// last is the last decrypted block
+	last []byte
+	err  error
+}
+
+func (r *cbcDecryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *cbcDecryptReader) fill() {
+	n, err := r.src.Read(r.buf)
+	data := append(r.pending, r.buf[:n]...)
+	blockSize := r.mode.BlockSize()
+	full := len(data) - len(data)%blockSize
+	if full > 0 {
+		decData := make([]byte, len(r.last)+full)
+		copy(decData, r.last)
+		r.mode.CryptBlocks(decData[len(r.last):], data[:full])
+		r.out = append(r.out, decData[:len(decData)-blockSize]...)
+		r.last = decData[len(decData)-blockSize:]
+	}
+	r.pending = append([]byte{}, data[full:]...)
+
+	if err == nil {
+		return
+	}
+	if err != io.EOF {
+		r.err = err
+		return
+	}
+	if len(r.pending) != 0 || r.last == nil {
+		r.err = fmt.Errorf("bad encrypted stream length, it must be a multiple of %d", blockSize)
+		return
+	}
+	out, err := pkcs7Unpad(r.last, blockSize)
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.out = append(r.out, out...)
+	r.last = nil
+	r.err = io.EOF
+}
+
+// lineWriter inserts a new line every lineLength bytes, the last line ends with a new line on Close
+type lineWriter struct {
+	w          io.Writer
+	lineLength int
+	column     int
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	for _, b := range p {
+		buf.WriteByte(b)
+		l.column++
+		if l.column == l.lineLength {
+			buf.WriteByte('\n')
+			l.column = 0
+		}
+	}
+	_, err := l.w.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (l *lineWriter) Close() error {
+	if l.column == 0 {
+		return nil
+	}
+	l.column = 0
+	_, err := l.w.Write([]byte{'\n'})
+	return err
+}
+
+// multiCloser closes next after closing its WriteCloser
+type multiCloser struct {
+	io.WriteCloser
+	next io.Closer
+}
+
+func (m *multiCloser) Close() error {
+	err := m.WriteCloser.Close()
+	if err != nil {
+		return err
+	}
+	return m.next.Close()
+}
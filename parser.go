@@ -1,65 +1,197 @@
 package pubtkt
 
 import (
-	"reflect"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/mitchellh/mapstructure"
 )
 
+// ParseTicket parses a plain ticket (e.g.: uid=myuser;validuntil=1600000000;sig=...) in a single pass.
+// Fields are separated by ';' and their value starts after the first '=', unknown fields are kept in Extensions.
+// When a field is repeated the last one is kept, a field written in lowercase takes precedence over the same
+// field written in another case. Like mod_auth_pubtkt, the ticket is cut at ";sig=": fields after sig are not signed,
+// they are ignored. See ParseTicketStrict to refuse ambiguous tickets.
 func ParseTicket(ticketStr string) (*Ticket, error) {
-	ticketMap := parseStringToMap(ticketStr)
+	return parseTicket(ticketStr, false, false)
+}
+
+// ParseTicketStrict parses a plain ticket like ParseTicket but refuses with ErrMalformedTicket tickets with
+// repeated fields, empty keys, fields without '=', fields after sig (they are not signed) or malformed timestamps.
+func ParseTicketStrict(ticketStr string) (*Ticket, error) {
+	return parseTicket(ticketStr, true, false)
+}
+
+// ParseEscapedTicket parses a plain ticket with escaped values (see EscapeTicketValue), strictly or not.
+// It gives ErrMalformedTicket when a value is not correctly escaped.
+func ParseEscapedTicket(ticketStr string, strict bool) (*Ticket, error) {
+	return parseTicket(ticketStr, strict, true)
+}
 
-	ticketParts := strings.SplitN(ticketStr, ";sig=", 2)
-	if len(ticketParts) < 2 {
+func parseTicket(ticketStr string, strict, unescape bool) (*Ticket, error) {
+	sigIdx := strings.Index(ticketStr, ";sig=")
+	if sigIdx < 0 {
 		return nil, NewErrNoSig()
 	}
 
 	ticket := &Ticket{
-		RawData: ticketParts[0],
+		RawData: ticketStr[:sigIdx],
 	}
-	config := mapstructure.DecoderConfig{
-		DecodeHook: ticketDecoderHook,
-		Result:     ticket,
+	// values which need a conversion are converted once the last one is known
+	var validuntil, graceperiod, tokens string
+	var validuntilOffset, graceperiodOffset, tokensOffset int
+	var hasValiduntil, hasGraceperiod, hasTokens bool
+	// lowercased are the known fields found written in lowercase, as bits (see knownFieldBit)
+	var lowercased uint16
+	// seen are the fields already found, only used when strict
+	seen := make([]string, 0, 16)
+	offset := 0
+	rest := ticketStr
+	for {
+		elem := rest
+		end := strings.IndexByte(rest, ';')
+		if end >= 0 {
+			elem = rest[:end]
+		}
+		trimmed := strings.TrimSpace(elem)
+		elemOffset := offset + len(elem) - len(strings.TrimLeft(elem, " \t\r\n"))
+		key, value, hasValue := splitTicketField(trimmed)
+		valueOffset := elemOffset + len(key) + 1
+		field := strings.ToLower(key)
+		if strict {
+			err := checkStrictField(field, hasValue, elemOffset, seen)
+			if err != nil {
+				return nil, err
+			}
+			if field == "sig" && end >= 0 {
+				return nil, NewErrMalformedTicket(field, offset+end+1, "fields after sig are not signed")
+			}
+			seen = append(seen, field)
+		}
+		// tokens are unescaped once split
+		if unescape && field != "sig" && field != "tokens" {
+			var err error
+			value, err = unescapeTicketValue(field, value, valueOffset)
+			if err != nil {
+				return nil, err
+			}
+		}
+		bit := knownFieldBit(field)
+		if key != field && lowercased&bit != 0 {
+			field = ""
+		}
+		if key == field {
+			lowercased |= bit
+		}
+		switch field {
+		case "":
+			// empty key or field already found written in lowercase
+		case "uid":
+			ticket.Uid = value
+		case "cip":
+			ticket.Cip = value
+		case "bauth":
+			ticket.Bauth = value
+		case "validuntil":
+			validuntil, validuntilOffset, hasValiduntil = value, valueOffset, true
+		case "graceperiod":
+			graceperiod, graceperiodOffset, hasGraceperiod = value, valueOffset, true
+		case "tokens":
+			tokens, tokensOffset, hasTokens = value, valueOffset, true
+		case "udata":
+			ticket.Udata = value
+		case "kid":
+			ticket.Kid = value
+		case "sig":
+			ticket.Sig = value
+		default:
+			ticket.Extensions.Set(key, value)
+		}
+		// the signature is the last field, fields after it are not signed
+		if end < 0 || offset > sigIdx {
+			break
+		}
+		offset += end + 1
+		rest = rest[end+1:]
 	}
 
-	decoder, err := mapstructure.NewDecoder(&config)
-	if err != nil {
-		return nil, err
+	var err error
+	if hasValiduntil {
+		ticket.Validuntil, err = parseTimestamp("validuntil", validuntil, validuntilOffset)
+		if err != nil {
+			return nil, err
+		}
 	}
-	err = decoder.Decode(ticketMap)
-	if err != nil {
-		return nil, err
+	if hasGraceperiod {
+		ticket.Graceperiod, err = parseTimestamp("graceperiod", graceperiod, graceperiodOffset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hasTokens {
+		ticket.Tokens = strings.Split(tokens, ",")
+	}
+	for i := 0; unescape && i < len(ticket.Tokens); i++ {
+		token := ticket.Tokens[i]
+		ticket.Tokens[i], err = unescapeTicketValue("tokens", token, tokensOffset)
+		if err != nil {
+			return nil, err
+		}
+		tokensOffset += len(token) + 1
 	}
 	return ticket, nil
 }
 
-func parseStringToMap(raw string) map[string]string {
-	rawMap := make(map[string]string)
-	elems := strings.Split(raw, ";")
-	for _, elem := range elems {
-		elem = strings.TrimSpace(elem)
-		elemParsed := strings.Split(elem, "=")
-		if len(elemParsed) == 1 {
-			rawMap[elemParsed[0]] = ""
-			continue
+// knownTicketFields are the fields of Ticket in a ticket
+var knownTicketFields = [...]string{"uid", "cip", "bauth", "validuntil", "graceperiod", "tokens", "udata", "kid", "sig"}
+
+// knownFieldBit gives a bit for each known field, 0 for the other fields
+func knownFieldBit(field string) uint16 {
+	for i, knownField := range knownTicketFields {
+		if knownField == field {
+			return 1 << i
 		}
-		rawMap[elemParsed[0]] = strings.Join(elemParsed[1:], "=")
 	}
-	return rawMap
+	return 0
 }
-func ticketDecoderHook(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
-	if t == reflect.TypeOf(time.Time{}) && f == reflect.TypeOf("") {
-		timestamp, err := strconv.ParseInt(data.(string), 10, 64)
-		if err != nil {
-			return nil, err
+
+// checkStrictField refuses empty keys, fields without value and repeated fields
+func checkStrictField(field string, hasValue bool, offset int, seen []string) error {
+	if field == "" {
+		return NewErrMalformedTicket(field, offset, "empty key")
+	}
+	if !hasValue {
+		return NewErrMalformedTicket(field, offset, "missing '='")
+	}
+	for _, seenField := range seen {
+		if seenField == field {
+			return NewErrMalformedTicket(field, offset, "repeated field")
 		}
-		return time.Unix(timestamp, 0), nil
 	}
-	if t == reflect.TypeOf([]string{}) && f == reflect.TypeOf("") {
-		return strings.Split(data.(string), ","), nil
+	return nil
+}
+
+// splitTicketField splits a key=value element, value is empty if there is no '='
+func splitTicketField(elem string) (string, string, bool) {
+	eq := strings.IndexByte(elem, '=')
+	if eq < 0 {
+		return elem, "", false
+	}
+	return elem[:eq], elem[eq+1:], true
+}
+
+// unescapeTicketValue unescapes the value of field found at offset in the ticket
+func unescapeTicketValue(field, value string, offset int) (string, error) {
+	unescaped, badIdx := unescapeValue(value)
+	if badIdx >= 0 {
+		return "", NewErrMalformedTicket(field, offset+badIdx, "invalid escape sequence")
+	}
+	return unescaped, nil
+}
+
+func parseTimestamp(field, value string, offset int) (time.Time, error) {
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, NewErrMalformedTicket(field, offset, "not a valid timestamp")
 	}
-	return data, nil
+	return time.Unix(timestamp, 0), nil
 }
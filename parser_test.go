@@ -0,0 +1,179 @@
+package pubtkt_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/orange-cloudfoundry/go-auth-pubtkt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const benchTicket = "uid=myuser;cip=127.0.0.1;bauth=dXNlcjpwYXNzd29yZA==;validuntil=1600003600;graceperiod=1600003000;" +
+	"tokens=token1,token2,token3;udata=mydata;kid=mykey;sig=MEUCIQCrjZ2g4nGf3lw7Hh4lqE8Xv1B5lQ1x9n2ZqOqf+Y2SPgIgV3VqPl2fKFhJ1yZ0s9vU5GmBvKZ7k8bCkbwX4x7m3Hk="
+
+var _ = Describe("ParseTicket", func() {
+	It("should parse all fields", func() {
+		ticket, err := ParseTicket(benchTicket)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ticket).To(Equal(&Ticket{
+			Uid:         "myuser",
+			Cip:         "127.0.0.1",
+			Bauth:       "dXNlcjpwYXNzd29yZA==",
+			Validuntil:  time.Unix(1600003600, 0),
+			Graceperiod: time.Unix(1600003000, 0),
+			Tokens:      []string{"token1", "token2", "token3"},
+			Udata:       "mydata",
+			Kid:         "mykey",
+			Sig:         "MEUCIQCrjZ2g4nGf3lw7Hh4lqE8Xv1B5lQ1x9n2ZqOqf+Y2SPgIgV3VqPl2fKFhJ1yZ0s9vU5GmBvKZ7k8bCkbwX4x7m3Hk=",
+			RawData: "uid=myuser;cip=127.0.0.1;bauth=dXNlcjpwYXNzd29yZA==;validuntil=1600003600;graceperiod=1600003000;" +
+				"tokens=token1,token2,token3;udata=mydata;kid=mykey",
+		}))
+	})
+	It("should keep the last value of a repeated field", func() {
+		ticket, err := ParseTicket("uid=first; validuntil=bad;uid=last;validuntil=42;tokens;sig=c2ln")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ticket.Uid).To(Equal("last"))
+		Expect(ticket.Validuntil).To(Equal(time.Unix(42, 0)))
+		Expect(ticket.Tokens).To(Equal([]string{""}))
+		Expect(ticket.Sig).To(Equal("c2ln"))
+	})
+	It("should give precedence to fields written in lowercase", func() {
+		ticket, err := ParseTicket("uid=first;UID=last;Kid=first;kid=last;Udata=first;UDATA=last;sig=c2ln")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ticket.Uid).To(Equal("first"))
+		Expect(ticket.Kid).To(Equal("last"))
+		Expect(ticket.Udata).To(Equal("last"))
+	})
+	It("should ignore fields after the signature", func() {
+		ticket, err := ParseTicket("uid=myuser;tokens=user;sig=c2ln;uid=admin;tokens=admin;validuntil=4102444800;sig=b3RoZXI=")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ticket.Uid).To(Equal("myuser"))
+		Expect(ticket.Tokens).To(Equal([]string{"user"}))
+		Expect(ticket.Validuntil).To(BeZero())
+		Expect(ticket.Sig).To(Equal("c2ln"))
+		Expect(ticket.RawData).To(Equal("uid=myuser;tokens=user"))
+	})
+	It("should keep unknown fields signed in their order as extensions", func() {
+		ticket, err := ParseTicket("uid=myuser;multifactor=1;iat=42;other;multifactor=2;sig=c2ln;after=sig")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ticket.Extensions).To(Equal(TicketFields{
+			{Key: "multifactor", Value: "2"},
+			{Key: "iat", Value: "42"},
+			{Key: "other", Value: ""},
+		}))
+		value, ok := ticket.Extensions.Get("iat")
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal("42"))
+		_, ok = ticket.Extensions.Get("after")
+		Expect(ok).To(BeFalse())
+	})
+	It("should fail when there is no signature or a timestamp is not valid", func() {
+		_, err := ParseTicket("uid=myuser;validuntil=42")
+		Expect(err).To(BeAssignableToTypeOf(ErrNoSig("")))
+
+		_, err = ParseTicket("uid=myuser;graceperiod=soon;sig=c2ln")
+		Expect(err).To(Equal(ErrMalformedTicket{Field: "graceperiod", Offset: 23, Reason: "not a valid timestamp"}))
+	})
+	Context("When strict", func() {
+		It("should parse valid tickets like ParseTicket", func() {
+			ticket, err := ParseTicketStrict(benchTicket)
+			Expect(err).ToNot(HaveOccurred())
+			expected, err := ParseTicket(benchTicket)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ticket).To(Equal(expected))
+		})
+		It("should refuse ambiguous tickets with the field and its offset", func() {
+			for ticketStr, expectedErr := range map[string]ErrMalformedTicket{
+				"uid=admin;cip=127.0.0.1;uid=myuser;sig=c2ln":   {Field: "uid", Offset: 24, Reason: "repeated field"},
+				"uid=myuser; UID=admin;sig=c2ln":                {Field: "uid", Offset: 12, Reason: "repeated field"},
+				"uid=myuser;;sig=c2ln":                          {Field: "", Offset: 11, Reason: "empty key"},
+				"=myuser;sig=c2ln":                              {Field: "", Offset: 0, Reason: "empty key"},
+				"uid=myuser;tokens;sig=c2ln":                    {Field: "tokens", Offset: 11, Reason: "missing '='"},
+				"uid=myuser;validuntil=12a;sig=c2ln":            {Field: "validuntil", Offset: 22, Reason: "not a valid timestamp"},
+				"uid=myuser;validuntil=;sig=c2ln":               {Field: "validuntil", Offset: 22, Reason: "not a valid timestamp"},
+				"uid=myuser;sig=c2ln;tokens=admin":              {Field: "sig", Offset: 20, Reason: "fields after sig are not signed"},
+				"uid=myuser;validuntil=bad;validuntil=1;sig=c2": {Field: "validuntil", Offset: 26, Reason: "repeated field"},
+			} {
+				_, err := ParseTicketStrict(ticketStr)
+				Expect(err).To(Equal(expectedErr), ticketStr)
+			}
+		})
+		It("should be used by AuthPubTkt with TKTAuthStrictParsing", func() {
+			options := AuthPubTktOptions{
+				TKTAuthPublicKey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIArcObzYlWhNkcMy+GBw0mJ5lDAvZScCnV8KeCZhJLig",
+				TKTAuthHeader:    []string{"cookie"},
+			}
+			auth, err := NewAuthPubTkt(options)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = auth.RawToTicket("uid=admin;uid=myuser;sig=c2ln")
+			Expect(err).ToNot(HaveOccurred())
+
+			options.TKTAuthStrictParsing = true
+			auth, err = NewAuthPubTkt(options)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = auth.RawToTicket("uid=admin;uid=myuser;sig=c2ln")
+			Expect(err).To(BeAssignableToTypeOf(ErrMalformedTicket{}))
+		})
+	})
+	Context("When values are escaped", func() {
+		It("should escape reserved characters and give them back", func() {
+			for value, escaped := range map[string]string{
+				"myuser":               "myuser",
+				"my;user=admin":        "my%3Buser%3Dadmin",
+				`{"name":"a, b"}`:      `{"name":"a%2C%20b"}`,
+				"100%":                 "100%25",
+				" spaces\t":            "%20spaces%09",
+				"dXNlcjpwYXNzd29yZA==": "dXNlcjpwYXNzd29yZA%3D%3D",
+				"ünicode\n":            "ünicode%0A",
+			} {
+				Expect(EscapeTicketValue(value)).To(Equal(escaped), value)
+				unescaped, err := UnescapeTicketValue(escaped)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(unescaped).To(Equal(value))
+			}
+			for _, escaped := range []string{"%", "a%3", "%3G", "%%41"} {
+				_, err := UnescapeTicketValue(escaped)
+				Expect(err).To(HaveOccurred(), escaped)
+			}
+		})
+		It("should parse back the values of a ticket", func() {
+			ticket := &Ticket{
+				Uid:        "my;user",
+				Validuntil: time.Unix(42, 0),
+				Tokens:     []string{"a,b", "c=d"},
+				Udata:      `{"locale":"fr"; "tenant": "t1"}`,
+				Extensions: TicketFields{{Key: "multifactor", Value: "otp;sms"}},
+				Sig:        "c2ln",
+			}
+			Expect(ticket.EscapedString()).To(Equal("uid=my%3Buser;validuntil=42;tokens=a%2Cb,c%3Dd;" +
+				`udata={"locale":"fr"%3B%20"tenant":%20"t1"};multifactor=otp%3Bsms;sig=c2ln`))
+
+			for _, strict := range []bool{false, true} {
+				parsed, err := ParseEscapedTicket(ticket.EscapedString(), strict)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(parsed.RawData).To(Equal(ticket.EscapedDataString()))
+				parsed.RawData = ""
+				Expect(parsed).To(Equal(ticket))
+			}
+		})
+		It("should refuse values not correctly escaped with their offset", func() {
+			_, err := ParseEscapedTicket("uid=my%user;sig=c2ln", false)
+			Expect(err).To(Equal(ErrMalformedTicket{Field: "uid", Offset: 6, Reason: "invalid escape sequence"}))
+
+			_, err = ParseEscapedTicket("uid=myuser;tokens=a,b%2;sig=c2ln", false)
+			Expect(err).To(Equal(ErrMalformedTicket{Field: "tokens", Offset: 21, Reason: "invalid escape sequence"}))
+		})
+	})
+})
+
+func BenchmarkParseTicket(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := ParseTicket(benchTicket)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
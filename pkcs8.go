@@ -0,0 +1,153 @@
+package pubtkt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Encrypted PKCS#8 private keys, see RFC 5208 section 6 and RFC 8018 (PKCS #5 v2.1)
+// Only PBES2 with PBKDF2 is supported, this is what OpenSSL creates by default
+// (e.g. openssl pkcs8 -topk8 -v2 aes-256-cbc).
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// pbkdf2PRF gives the hash used by the PBKDF2 pseudorandom function, HMAC-SHA1 by default.
+func pbkdf2PRF(prf pkix.AlgorithmIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(prf.Algorithm) == 0, prf.Algorithm.Equal(oidHMACWithSHA1):
+		return sha1.New, nil
+	case prf.Algorithm.Equal(oidHMACWithSHA224):
+		return sha256.New224, nil
+	case prf.Algorithm.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	case prf.Algorithm.Equal(oidHMACWithSHA384):
+		return sha512.New384, nil
+	case prf.Algorithm.Equal(oidHMACWithSHA512):
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %s", prf.Algorithm)
+}
+
+// pbes2Cipher gives the block cipher constructor and key size of the PBES2 encryption scheme.
+func pbes2Cipher(scheme asn1.ObjectIdentifier) (func([]byte) (cipher.Block, error), int, error) {
+	switch {
+	case scheme.Equal(oidAES128CBC):
+		return aes.NewCipher, 16, nil
+	case scheme.Equal(oidAES192CBC):
+		return aes.NewCipher, 24, nil
+	case scheme.Equal(oidAES256CBC):
+		return aes.NewCipher, 32, nil
+	case scheme.Equal(oidDESEDE3CBC):
+		return des.NewTripleDESCipher, 24, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported PBES2 encryption scheme %s", scheme)
+}
+
+// decryptPKCS8PrivateKey decrypts an encrypted PKCS#8 private key and gives the
+// DER of the PKCS#8 private key. If wrong passphrase, return x509.IncorrectPasswordError.
+func decryptPKCS8PrivateKey(der, passPhrase []byte) ([]byte, error) {
+	var keyInfo encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &keyInfo); err != nil {
+		return nil, errors.New("ssh: failed to parse encrypted private key: " + err.Error())
+	}
+	if !keyInfo.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("ssh: unsupported private key encryption %s, only PBES2 is supported", keyInfo.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(keyInfo.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("ssh: failed to parse PBES2 parameters: " + err.Error())
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("ssh: unsupported key derivation function %s, only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errors.New("ssh: failed to parse PBKDF2 parameters: " + err.Error())
+	}
+	prf, err := pbkdf2PRF(kdfParams.PRF)
+	if err != nil {
+		return nil, errors.New("ssh: " + err.Error())
+	}
+	newCipher, keySize, err := pbes2Cipher(params.EncryptionScheme.Algorithm)
+	if err != nil {
+		return nil, errors.New("ssh: " + err.Error())
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keySize {
+		return nil, errors.New("ssh: PBKDF2 key length doesn't match the encryption scheme")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New("ssh: failed to parse encryption scheme parameters: " + err.Error())
+	}
+
+	key := pbkdf2.Key(passPhrase, kdfParams.Salt, kdfParams.IterationCount, keySize, prf)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("ssh: invalid IV size")
+	}
+	data := keyInfo.EncryptedData
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("ssh: invalid encrypted private key size")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// like x509.DecryptPEMBlock, a wrong padding is most likely a wrong passphrase
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, x509.IncorrectPasswordError
+	}
+	for _, b := range out[len(out)-padding:] {
+		if int(b) != padding {
+			return nil, x509.IncorrectPasswordError
+		}
+	}
+	return out[:len(out)-padding], nil
+}
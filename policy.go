@@ -0,0 +1,107 @@
+package pubtkt
+
+import (
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+)
+
+// Key types which can be set in TKTAuthAllowedKeyTypes
+const (
+	KeyTypeRSA     = "RSA"
+	KeyTypeDSA     = "DSA"
+	KeyTypeECDSA   = "ECDSA"
+	KeyTypeED25519 = "ED25519"
+)
+
+// algorithmPolicy restricts the algorithms allowed to create and verify ticket signatures
+type algorithmPolicy struct {
+	// keyTypes are the allowed key types, nil if all are allowed
+	keyTypes map[string]bool
+	// minRSAKeySize is the minimum RSA modulus size in bits
+	minRSAKeySize int
+	// digests are the allowed digests (as understood by FindHash), nil if all are allowed
+	digests map[hashMethod]bool
+}
+
+func newAlgorithmPolicy(options AuthPubTktOptions) (algorithmPolicy, error) {
+	policy := algorithmPolicy{
+		minRSAKeySize: options.TKTAuthMinRSAKeySize,
+	}
+	if len(options.TKTAuthAllowedKeyTypes) > 0 {
+		policy.keyTypes = make(map[string]bool)
+		for _, keyType := range options.TKTAuthAllowedKeyTypes {
+			keyType = strings.ToUpper(keyType)
+			switch keyType {
+			case KeyTypeRSA, KeyTypeDSA, KeyTypeECDSA, KeyTypeED25519:
+				policy.keyTypes[keyType] = true
+			default:
+				return policy, fmt.Errorf("unknown key type %s in TKTAuthAllowedKeyTypes", keyType)
+			}
+		}
+	}
+	if len(options.TKTAuthAllowedDigests) > 0 {
+		policy.digests = make(map[hashMethod]bool)
+		for _, digest := range options.TKTAuthAllowedDigests {
+			method := hashMethod(strings.ToLower(digest))
+			if method == "dss1" {
+				method = Hsha1
+			}
+			if _, _, err := FindHash(string(method)); err != nil {
+				return policy, fmt.Errorf("unknown digest %s in TKTAuthAllowedDigests", digest)
+			}
+			policy.digests[method] = true
+		}
+	}
+	return policy, nil
+}
+
+// check gives an ErrWeakAlgorithm if ticket signatures made with the given key
+// and TKTAuthDigest option are not allowed.
+func (p algorithmPolicy) check(pubKey crypto.PublicKey, authDigest string) error {
+	keyType, keyName := keyTypeName(pubKey)
+	if keyType == "" {
+		return fmt.Errorf("unsupported public key type %T", pubKey)
+	}
+	algorithm := keyName
+	var digest string
+	if keyType != KeyTypeED25519 {
+		var err error
+		digest, err = ticketDigest(pubKey, authDigest)
+		if err != nil {
+			return err
+		}
+		algorithm += " with " + strings.ToUpper(digest)
+	}
+
+	if p.keyTypes != nil && !p.keyTypes[keyType] {
+		return NewErrWeakAlgorithm(algorithm)
+	}
+	if rsaPub, ok := pubKey.(*rsa.PublicKey); ok && rsaPub.N.BitLen() < p.minRSAKeySize {
+		return NewErrWeakAlgorithm(algorithm)
+	}
+	if digest != "" && p.digests != nil && !p.digests[hashMethod(digest)] {
+		return NewErrWeakAlgorithm(algorithm)
+	}
+	return nil
+}
+
+// keyTypeName gives the key type and a name of the key with its size (e.g. RSA-2048, ECDSA-P256)
+func keyTypeName(pubKey crypto.PublicKey) (string, string) {
+	switch pub := pubKey.(type) {
+	case *rsa.PublicKey:
+		return KeyTypeRSA, fmt.Sprintf("%s-%d", KeyTypeRSA, pub.N.BitLen())
+	case *dsa.PublicKey:
+		return KeyTypeDSA, fmt.Sprintf("%s-%d", KeyTypeDSA, pub.P.BitLen())
+	case *ecdsa.PublicKey:
+		return KeyTypeECDSA, fmt.Sprintf("%s-%s", KeyTypeECDSA, strings.ReplaceAll(pub.Curve.Params().Name, "-", ""))
+	case ed25519.PublicKey:
+		return KeyTypeED25519, KeyTypeED25519
+	default:
+		return "", ""
+	}
+}
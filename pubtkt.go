@@ -1,16 +1,21 @@
 package pubtkt
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
 	"crypto/dsa"
-	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
-	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
-	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,26 +37,113 @@ type AuthPubTkt interface {
 	// VerifyTicket Verify a ticket with signature, expiration, token (if set) and ip (against the provided ip and if TKTCheckIpEnabled option is true)
 	VerifyTicket(ticket *Ticket, clientIp string) error
 	// SignTicket This will add a signature to the ticket with private key set with TKTAuthPrivateKey option
+	// (and the key id set with TKTAuthPrivateKeyID option as kid field), or the mod_auth_tkt digest with TKTAuthSecret option
 	SignTicket(ticket *Ticket) error
+	// Close stops watching files set in options (e.g.: TKTAuthPublicKeyFile), if any
+	Close() error
 }
 
 type AuthPubTktImpl struct {
 	options AuthPubTktOptions
 	openSSL *OpenSSL
+	// modAuthTkt is set when tickets are mod_auth_tkt tickets (TKTAuthSecret option)
+	modAuthTkt *modAuthTkt
+	// keys is swapped when files set in options change
+	keys    *atomic.Pointer[authKeys]
+	watcher *fileWatcher
 }
 
 var TimeNowFunc = func() time.Time {
 	return time.Now()
 }
 
+// NewAuthPubTkt creates an AuthPubTkt from options, it must be closed to stop watching files set in options
 func NewAuthPubTkt(options AuthPubTktOptions) (AuthPubTkt, error) {
-	if options.TKTAuthPublicKey == "" {
-		return nil, fmt.Errorf("TKTAuthPublicKey must be set")
+	isModAuthTkt := options.TKTAuthSecret != "" || options.TKTAuthSecretFile != ""
+	if options.TKTAuthPublicKey == "" && options.TKTAuthPublicKeyFile == "" && len(options.TKTAuthPublicKeys) == 0 && !isModAuthTkt {
+		return nil, fmt.Errorf("TKTAuthPublicKey, TKTAuthPublicKeyFile, TKTAuthPublicKeys, TKTAuthSecret or TKTAuthSecretFile must be set")
 	}
 	if options.TKTAuthHeader == nil || len(options.TKTAuthHeader) == 0 {
 		return nil, fmt.Errorf("TKTAuthHeader must be set")
 	}
-	return &AuthPubTktImpl{options, NewOpenSSL()}, nil
+	hasCipherPasswd := options.TKTCypherTicketsWithPasswd != "" || options.TKTCypherTicketsWithPasswdFile != "" ||
+		len(options.TKTCypherTicketsWithPasswds) > 0
+	if options.TKTCypherTicketsAcceptPlain && !hasCipherPasswd {
+		return nil, fmt.Errorf("TKTCypherTicketsAcceptPlain requires a passphrase to decrypt tickets")
+	}
+	if options.TKTCypherTicketsIssuePlain && !options.TKTCypherTicketsAcceptPlain {
+		return nil, fmt.Errorf("TKTCypherTicketsIssuePlain requires TKTCypherTicketsAcceptPlain")
+	}
+	if options.TKTCypherTicketsAcceptPlain && isModAuthTkt {
+		// plain mod_auth_tkt tickets are base64 encoded, they can't be told apart from encrypted tickets
+		return nil, fmt.Errorf("TKTCypherTicketsAcceptPlain can't be used with TKTAuthSecret or TKTAuthSecretFile")
+	}
+	if options.TKTAuthEscapeValues && isModAuthTkt {
+		return nil, fmt.Errorf("TKTAuthEscapeValues can't be used with TKTAuthSecret or TKTAuthSecretFile")
+	}
+	err := checkOptionsFiles(options)
+	if err != nil {
+		return nil, err
+	}
+	openSSL, err := NewOpenSSLWithKDF(OpenSSLKDF{
+		Digest:           options.TKTCypherTicketsDigest,
+		PBKDF2Iterations: options.TKTCypherTicketsPBKDF2Iter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	auth := &AuthPubTktImpl{
+		options: options,
+		openSSL: openSSL,
+		keys:    &atomic.Pointer[authKeys]{},
+	}
+	if isModAuthTkt {
+		auth.modAuthTkt, err = newModAuthTkt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = auth.reload()
+	if err != nil {
+		return nil, err
+	}
+	files := optionsFiles(options)
+	if len(files) == 0 {
+		return auth, nil
+	}
+	auth.watcher, err = newFileWatcher(files, func() {
+		err := auth.reload()
+		if err != nil {
+			ReloadErrorFunc(err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// reload loads key material from options (and files set in options)
+// previous key material is kept if an error occurred
+func (a AuthPubTktImpl) reload() error {
+	options, err := loadOptionsFiles(a.options)
+	if err != nil {
+		return err
+	}
+	keys, err := newAuthKeys(options)
+	if err != nil {
+		return err
+	}
+	a.keys.Store(keys)
+	return nil
+}
+
+// Close stops watching files set in options, if any
+func (a AuthPubTktImpl) Close() error {
+	if a.watcher == nil {
+		return nil
+	}
+	return a.watcher.Close()
 }
 
 func (a AuthPubTktImpl) VerifyFromRequest(req *http.Request) (*Ticket, error) {
@@ -84,11 +176,7 @@ func (a AuthPubTktImpl) RequestToTicket(req *http.Request) (*Ticket, error) {
 				continue
 			}
 		}
-		cookieName := "auth_pubtkt"
-		if a.options.TKTAuthCookieName != "" {
-			cookieName = a.options.TKTAuthCookieName
-		}
-		cookie, err := req.Cookie(cookieName)
+		cookie, err := req.Cookie(a.cookieName())
 		if err != nil {
 			continue
 		}
@@ -129,18 +217,7 @@ func (a AuthPubTktImpl) TicketInHeader(inHeader http.Header, ticket *Ticket) err
 			inHeader.Set(header, ticketStr)
 			continue
 		}
-		cookieName := "auth_pubtkt"
-		if a.options.TKTAuthCookieName != "" {
-			cookieName = a.options.TKTAuthCookieName
-		}
-		cookie := &http.Cookie{
-			Name:    cookieName,
-			Path:    "/",
-			Domain:  a.options.TKTAuthDomain,
-			Value:   ticketStr,
-			Expires: ticket.Validuntil,
-			Secure:  a.options.TKTAuthSecureCookie,
-		}
+		cookie := a.ticketCookie(ticketStr, ticket)
 		if inHeader.Get("Cookie") != "" {
 			inHeader.Add("Cookie", cookie.String())
 		} else {
@@ -150,30 +227,153 @@ func (a AuthPubTktImpl) TicketInHeader(inHeader http.Header, ticket *Ticket) err
 	return nil
 }
 
+func (a AuthPubTktImpl) ticketCookie(ticketStr string, ticket *Ticket) *http.Cookie {
+	return &http.Cookie{
+		Name:    a.cookieName(),
+		Path:    "/",
+		Domain:  a.options.TKTAuthDomain,
+		Value:   ticketStr,
+		Expires: ticket.Validuntil,
+		Secure:  a.options.TKTAuthSecureCookie,
+	}
+}
+
+func (a AuthPubTktImpl) cookieName() string {
+	if a.options.TKTAuthCookieName != "" {
+		return a.options.TKTAuthCookieName
+	}
+	if a.modAuthTkt != nil {
+		return "auth_tkt"
+	}
+	return "auth_pubtkt"
+}
+
+// ticketInCookie tells if tickets are given in a cookie
+func (a AuthPubTktImpl) ticketInCookie() bool {
+	if len(a.options.TKTAuthHeader) == 0 {
+		return true
+	}
+	for _, header := range a.options.TKTAuthHeader {
+		if strings.ToLower(header) == "cookie" {
+			return true
+		}
+	}
+	return false
+}
+
 func (a AuthPubTktImpl) RawToTicket(ticketStr string) (*Ticket, error) {
-	var err error
-	if a.options.TKTCypherTicketsWithPasswd != "" {
-		ticketStr, err = a.decrypt(ticketStr)
+	cipherPasswds := a.keys.Load().cipherPasswds
+	format := DetectTicketFormat(ticketStr)
+	if len(cipherPasswds) == 0 || (a.options.TKTCypherTicketsAcceptPlain && format == TicketFormatPlain) {
+		ticket, err := a.parseTicket(ticketStr)
 		if err != nil {
 			return nil, err
 		}
+		if a.options.TKTCypherTicketsAcceptPlain {
+			ticket.Format = TicketFormatPlain
+		}
+		return ticket, nil
+	}
+	var err error
+	for i, cipherPasswd := range cipherPasswds {
+		var data string
+		data, err = a.decrypt(cipherPasswd, ticketStr)
+		if err != nil {
+			continue
+		}
+		// without integrity check (cbc and ecb), a wrong passphrase can still give a valid padding
+		var ticket *Ticket
+		ticket, err = a.parseTicket(data)
+		if err != nil {
+			continue
+		}
+		ticket.CipherPasswdIndex = i
+		if a.options.TKTCypherTicketsAcceptPlain {
+			ticket.Format = format
+		}
+		return ticket, nil
+	}
+	if _, isAEAD := aeadVersion(EncMethod(a.options.TKTCypherTicketsMethod)); isAEAD {
+		// a legacy ticket with a valid padding must not be told apart from the other failures
+		return nil, ErrTicketDecrypt
+	}
+	return nil, err
+}
+
+// parseTicket parses a decrypted ticket, as a mod_auth_tkt ticket if TKTAuthSecret is set,
+// strictly if TKTAuthStrictParsing is set and with escaped values if TKTAuthEscapeValues is set
+func (a AuthPubTktImpl) parseTicket(ticketStr string) (*Ticket, error) {
+	if a.modAuthTkt != nil {
+		return a.modAuthTkt.parse(ticketStr)
+	}
+	if a.options.TKTAuthEscapeValues {
+		return ParseEscapedTicket(ticketStr, a.options.TKTAuthStrictParsing)
+	}
+	if a.options.TKTAuthStrictParsing {
+		return ParseTicketStrict(ticketStr)
 	}
 	return ParseTicket(ticketStr)
 }
 
+// ticketString gives a signed ticket before encryption, as a mod_auth_tkt ticket if TKTAuthSecret is set
+func (a AuthPubTktImpl) ticketString(ticket *Ticket) string {
+	if a.modAuthTkt != nil {
+		return a.modAuthTkt.String(ticket)
+	}
+	if a.options.TKTAuthEscapeValues {
+		return ticket.EscapedString()
+	}
+	return ticket.String()
+}
+
+// dataString gives the signed part of the ticket, with escaped values if TKTAuthEscapeValues is set
+func (a AuthPubTktImpl) dataString(ticket *Ticket) string {
+	if a.options.TKTAuthEscapeValues {
+		return ticket.EscapedDataString()
+	}
+	return ticket.DataString()
+}
+
 func (a AuthPubTktImpl) TicketToRaw(ticket *Ticket) (string, error) {
 	err := a.SignTicket(ticket)
 	if err != nil {
 		return "", err
 	}
-	if a.options.TKTCypherTicketsWithPasswd != "" {
-		return a.encrypt(ticket)
+	return a.encryptTicket(ticket)
+}
+
+// encryptTicket gives the ticket encrypted with the current passphrase,
+// as it is if there is no passphrase or TKTCypherTicketsIssuePlain is set
+func (a AuthPubTktImpl) encryptTicket(ticket *Ticket) (string, error) {
+	cipherPasswds := a.keys.Load().cipherPasswds
+	if len(cipherPasswds) > 0 && !a.options.TKTCypherTicketsIssuePlain {
+		return a.encrypt(cipherPasswds[0], ticket)
+	}
+	return a.ticketString(ticket), nil
+}
+
+// ReissueTicketInResponse sets in a cookie a ticket decrypted with an older passphrase
+// (see Ticket.CipherPasswdIndex), encrypted again with the current passphrase.
+// The ticket is not signed again and nothing is done if cookies are not in TKTAuthHeader.
+func (a AuthPubTktImpl) ReissueTicketInResponse(resp http.ResponseWriter, ticket *Ticket) error {
+	if !a.ticketInCookie() {
+		return nil
+	}
+	ticketStr, err := a.encryptTicket(ticket)
+	if err != nil {
+		return err
 	}
-	return ticket.String(), nil
+	http.SetCookie(resp, a.ticketCookie(url.QueryEscape(ticketStr), ticket))
+	return nil
 }
 
 func (a AuthPubTktImpl) VerifyTicket(ticket *Ticket, clientIp string) error {
-	err := a.verifySignature(ticket)
+	var err error
+	if a.modAuthTkt != nil {
+		err = a.modAuthTkt.verify(a.keys.Load().secret, ticket, clientIp)
+	} else {
+		err = a.verifySignature(ticket)
+	}
 	if err != nil {
 		return err
 	}
@@ -228,64 +428,98 @@ func (a AuthPubTktImpl) verifyExpiration(ticket *Ticket) error {
 }
 
 func (a AuthPubTktImpl) verifySignature(ticket *Ticket) error {
-	authDigest := strings.ToLower(a.options.TKTAuthDigest)
-	if a.options.TKTAuthDigest == "" || authDigest == "dss1" {
-		err := a.verifyDsaSignature(ticket)
-		if err == nil || authDigest == "dss1" {
+	keys := a.keys.Load()
+	now := TimeNowFunc()
+	if ticket.Kid != "" {
+		key, ok := keys.verifyKey(ticket.Kid)
+		if !ok {
+			return NewErrSigNotValid(fmt.Errorf("unknown key id %s", ticket.Kid))
+		}
+		if err := key.check(now); err != nil {
+			return NewErrSigNotValid(err)
+		}
+		if err := keys.policy.check(key.publicKey, a.options.TKTAuthDigest); err != nil {
 			return err
 		}
+		return a.verifySignatureWithKey(key.publicKey, ticket)
+	}
+	err := NewErrSigNotValid(fmt.Errorf("no active key found"))
+	for _, key := range keys.verifyKeys {
+		if key.check(now) != nil {
+			continue
+		}
+		if policyErr := keys.policy.check(key.publicKey, a.options.TKTAuthDigest); policyErr != nil {
+			err = policyErr
+			continue
+		}
+		err = a.verifySignatureWithKey(key.publicKey, ticket)
+		if err == nil {
+			return nil
+		}
 	}
-	return a.verifyRsaSignature(ticket)
+	return err
 }
 
-func (a AuthPubTktImpl) verifyDsaSignature(ticket *Ticket) error {
-	block, _ := pem.Decode([]byte(a.options.TKTAuthPublicKey))
-	if block == nil {
-		return fmt.Errorf("no TKTAuthPublicKey found")
+func (a AuthPubTktImpl) verifySignatureWithKey(pubKey crypto.PublicKey, ticket *Ticket) error {
+	switch pub := pubKey.(type) {
+	case *rsa.PublicKey:
+		return a.verifyRsaSignature(pub, ticket)
+	case *dsa.PublicKey:
+		return a.verifyDsaSignature(pub, ticket)
+	case *ecdsa.PublicKey:
+		return a.verifyEcdsaSignature(pub, ticket)
+	case ed25519.PublicKey:
+		return a.verifyEd25519Signature(pub, ticket)
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
 	}
-	cert, err := x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func (a AuthPubTktImpl) verifyDsaSignature(pub *dsa.PublicKey, ticket *Ticket) error {
+	ds, _ := base64.StdEncoding.DecodeString(ticket.Sig)
+	authDigest, err := ticketDigest(pub, a.options.TKTAuthDigest)
 	if err != nil {
-		return fmt.Errorf("error when parse public key: %s", err.Error())
+		return err
 	}
-	pub, isDsa := cert.(*dsa.PublicKey)
-	if !isDsa {
-		return fmt.Errorf("not a DSA Key")
+	hash, _, err := FindHash(authDigest)
+	if err != nil {
+		return fmt.Errorf("error when finding hash: %s", err.Error())
 	}
+	hash.Write([]byte(a.dataString(ticket)))
+	digest := hash.Sum(nil)
 
-	certif := x509.Certificate{
-		PublicKey: pub,
+	// OpenSSL (DSS1 or any other digest) gives the signature as ASN.1 DER encoded r and s
+	var dsaSig struct {
+		R, S *big.Int
 	}
-	signature, _ := base64.StdEncoding.DecodeString(ticket.Sig)
-	err = certif.CheckSignature(x509.DSAWithSHA1, []byte(ticket.DataString()), signature)
+	rest, err := asn1.Unmarshal(ds, &dsaSig)
 	if err != nil {
 		return NewErrSigNotValid(err)
 	}
-	return nil
-}
-
-func (a AuthPubTktImpl) verifyRsaSignature(ticket *Ticket) error {
-	block, _ := pem.Decode([]byte(a.options.TKTAuthPublicKey))
-	if block == nil {
-		return fmt.Errorf("no TKTAuthPublicKey found")
+	if len(rest) > 0 {
+		return NewErrSigNotValid(fmt.Errorf("garbage after DSA signature"))
 	}
-	cert, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return fmt.Errorf("error when parse public key: %s", err.Error())
+	// FIPS 186-3, section 4.6: hash must be truncated to the byte-length of the subgroup
+	if qLen := (pub.Q.BitLen() + 7) / 8; len(digest) > qLen {
+		digest = digest[:qLen]
 	}
-	pub, isRsa := cert.(*rsa.PublicKey)
-	if !isRsa {
-		return fmt.Errorf("not a RSA Key")
+	if !dsa.Verify(pub, digest, dsaSig.R, dsaSig.S) {
+		return NewErrSigNotValid()
 	}
+	return nil
+}
+
+func (a AuthPubTktImpl) verifyRsaSignature(pub *rsa.PublicKey, ticket *Ticket) error {
 	ds, _ := base64.StdEncoding.DecodeString(ticket.Sig)
-	authDigest := a.options.TKTAuthDigest
-	if authDigest == "" {
-		authDigest = "sha1"
+	authDigest, err := ticketDigest(pub, a.options.TKTAuthDigest)
+	if err != nil {
+		return err
 	}
 	hash, cryptoHash, err := FindHash(authDigest)
 	if err != nil {
 		return fmt.Errorf("error when finding hash: %s", err.Error())
 	}
-	hash.Write([]byte(ticket.DataString()))
+	hash.Write([]byte(a.dataString(ticket)))
 	digest := hash.Sum(nil)
 
 	err = rsa.VerifyPKCS1v15(pub, cryptoHash, digest, ds)
@@ -295,9 +529,39 @@ func (a AuthPubTktImpl) verifyRsaSignature(ticket *Ticket) error {
 	return nil
 }
 
-func (a AuthPubTktImpl) decrypt(encTkt string) (string, error) {
+func (a AuthPubTktImpl) verifyEcdsaSignature(pub *ecdsa.PublicKey, ticket *Ticket) error {
+	ds, _ := base64.StdEncoding.DecodeString(ticket.Sig)
+	authDigest, err := ticketDigest(pub, a.options.TKTAuthDigest)
+	if err != nil {
+		return err
+	}
+	hash, _, err := FindHash(authDigest)
+	if err != nil {
+		return fmt.Errorf("error when finding hash: %s", err.Error())
+	}
+	hash.Write([]byte(a.dataString(ticket)))
+	digest := hash.Sum(nil)
+
+	if !ecdsa.VerifyASN1(pub, digest, ds) {
+		return NewErrSigNotValid()
+	}
+	return nil
+}
+
+func (a AuthPubTktImpl) verifyEd25519Signature(pub ed25519.PublicKey, ticket *Ticket) error {
+	ds, _ := base64.StdEncoding.DecodeString(ticket.Sig)
+	if !ed25519.Verify(pub, []byte(a.dataString(ticket)), ds) {
+		return NewErrSigNotValid()
+	}
+	return nil
+}
+
+func (a AuthPubTktImpl) decrypt(cipherPasswd, encTkt string) (string, error) {
+	if _, isAEAD := aeadVersion(EncMethod(a.options.TKTCypherTicketsMethod)); isAEAD {
+		return a.decryptAEAD(cipherPasswd, encTkt)
+	}
 	data, err := a.openSSL.DecryptString(
-		a.options.TKTCypherTicketsWithPasswd,
+		cipherPasswd,
 		encTkt,
 		EncMethod(strings.ToUpper(a.options.TKTCypherTicketsMethod)))
 	if err != nil {
@@ -306,10 +570,45 @@ func (a AuthPubTktImpl) decrypt(encTkt string) (string, error) {
 	return string(data), nil
 }
 
-func (a AuthPubTktImpl) encrypt(ticket *Ticket) (string, error) {
+// decryptAEAD decrypts a ticket when an AEAD method is used, tickets encrypted like openssl
+// with TKTCypherTicketsLegacyMethod are still accepted. Any failure gives ErrTicketDecrypt.
+func (a AuthPubTktImpl) decryptAEAD(cipherPasswd, encTkt string) (string, error) {
+	envelope, err := base64.StdEncoding.DecodeString(encTkt)
+	if err != nil {
+		return "", ErrTicketDecrypt
+	}
+	if !bytes.HasPrefix(envelope, []byte(a.openSSL.openSSLSaltHeader)) {
+		data, err := decryptAEAD(cipherPasswd, envelope)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	if len(envelope) < 2*aes.BlockSize || len(envelope)%aes.BlockSize != 0 {
+		return "", ErrTicketDecrypt
+	}
+	legacyMethod := MethodCbc
+	if a.options.TKTCypherTicketsLegacyMethod != "" {
+		legacyMethod = EncMethod(strings.ToUpper(a.options.TKTCypherTicketsLegacyMethod))
+	}
+	data, err := a.openSSL.DecryptString(cipherPasswd, encTkt, legacyMethod)
+	if err != nil {
+		return "", ErrTicketDecrypt
+	}
+	return string(data), nil
+}
+
+func (a AuthPubTktImpl) encrypt(cipherPasswd string, ticket *Ticket) (string, error) {
+	if version, isAEAD := aeadVersion(EncMethod(a.options.TKTCypherTicketsMethod)); isAEAD {
+		envelope, err := encryptAEAD(cipherPasswd, []byte(a.ticketString(ticket)), version)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(envelope), nil
+	}
 	data, err := a.openSSL.EncryptString(
-		a.options.TKTCypherTicketsWithPasswd,
-		ticket.String(),
+		cipherPasswd,
+		a.ticketString(ticket),
 		EncMethod(strings.ToUpper(a.options.TKTCypherTicketsMethod)))
 	if err != nil {
 		return "", err
@@ -318,19 +617,36 @@ func (a AuthPubTktImpl) encrypt(ticket *Ticket) (string, error) {
 }
 
 func (a AuthPubTktImpl) SignTicket(ticket *Ticket) error {
-	if a.options.TKTAuthPrivateKey == "" {
-		return fmt.Errorf("no TKTAuthPrivateKey found")
+	keys := a.keys.Load()
+	if a.modAuthTkt != nil {
+		return a.modAuthTkt.sign(keys.secret, ticket)
+	}
+	if keys.signer == nil {
+		return fmt.Errorf("no TKTAuthPrivateKey, TKTAuthSigner or TKTAuthAgentSocket found")
+	}
+	if a.options.TKTAuthPrivateKeyID != "" && ticket.Kid == "" && ticket.RawData == "" {
+		ticket.Kid = a.options.TKTAuthPrivateKeyID
+	}
+	err := ticket.Extensions.checkKeys()
+	if err != nil {
+		return err
+	}
+	if !a.options.TKTAuthEscapeValues && ticket.RawData == "" {
+		err = ticket.checkValues()
+		if err != nil {
+			return err
+		}
 	}
 
-	signer, err := ParsePrivateKey([]byte(a.options.TKTAuthPrivateKey))
+	sign, err := signWithAlgorithm(keys.signer, []byte(a.dataString(ticket)), keys.signatureAlgorithm)
 	if err != nil {
-		return fmt.Errorf("error when parse private key: %s", err.Error())
+		return fmt.Errorf("error when create signature: %s", err.Error())
 	}
-	sign, err := signer.Sign(rand.Reader, []byte(ticket.DataString()))
+	blob, err := ticketSignatureBlob(sign)
 	if err != nil {
 		return fmt.Errorf("error when create signature: %s", err.Error())
 	}
 
-	ticket.Sig = base64.StdEncoding.EncodeToString(sign.Blob)
+	ticket.Sig = base64.StdEncoding.EncodeToString(blob)
 	return nil
 }
@@ -9,6 +9,16 @@ import (
 )
 
 type FakeAuthPubTkt struct {
+	CloseStub        func() error
+	closeMutex       sync.RWMutex
+	closeArgsForCall []struct {
+	}
+	closeReturns struct {
+		result1 error
+	}
+	closeReturnsOnCall map[int]struct {
+		result1 error
+	}
 	RawToTicketStub        func(string) (*pubtkt.Ticket, error)
 	rawToTicketMutex       sync.RWMutex
 	rawToTicketArgsForCall []struct {
@@ -124,21 +134,75 @@ type FakeAuthPubTkt struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeAuthPubTkt) Close() error {
+	fake.closeMutex.Lock()
+	ret, specificReturn := fake.closeReturnsOnCall[len(fake.closeArgsForCall)]
+	fake.closeArgsForCall = append(fake.closeArgsForCall, struct {
+	}{})
+	stub := fake.CloseStub
+	fakeReturns := fake.closeReturns
+	fake.recordInvocation("Close", []interface{}{})
+	fake.closeMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeAuthPubTkt) CloseCallCount() int {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return len(fake.closeArgsForCall)
+}
+
+func (fake *FakeAuthPubTkt) CloseCalls(stub func() error) {
+	fake.closeMutex.Lock()
+	defer fake.closeMutex.Unlock()
+	fake.CloseStub = stub
+}
+
+func (fake *FakeAuthPubTkt) CloseReturns(result1 error) {
+	fake.closeMutex.Lock()
+	defer fake.closeMutex.Unlock()
+	fake.CloseStub = nil
+	fake.closeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAuthPubTkt) CloseReturnsOnCall(i int, result1 error) {
+	fake.closeMutex.Lock()
+	defer fake.closeMutex.Unlock()
+	fake.CloseStub = nil
+	if fake.closeReturnsOnCall == nil {
+		fake.closeReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.closeReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeAuthPubTkt) RawToTicket(arg1 string) (*pubtkt.Ticket, error) {
 	fake.rawToTicketMutex.Lock()
 	ret, specificReturn := fake.rawToTicketReturnsOnCall[len(fake.rawToTicketArgsForCall)]
 	fake.rawToTicketArgsForCall = append(fake.rawToTicketArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.RawToTicketStub
+	fakeReturns := fake.rawToTicketReturns
 	fake.recordInvocation("RawToTicket", []interface{}{arg1})
 	fake.rawToTicketMutex.Unlock()
-	if fake.RawToTicketStub != nil {
-		return fake.RawToTicketStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.rawToTicketReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -193,15 +257,16 @@ func (fake *FakeAuthPubTkt) RequestToTicket(arg1 *http.Request) (*pubtkt.Ticket,
 	fake.requestToTicketArgsForCall = append(fake.requestToTicketArgsForCall, struct {
 		arg1 *http.Request
 	}{arg1})
+	stub := fake.RequestToTicketStub
+	fakeReturns := fake.requestToTicketReturns
 	fake.recordInvocation("RequestToTicket", []interface{}{arg1})
 	fake.requestToTicketMutex.Unlock()
-	if fake.RequestToTicketStub != nil {
-		return fake.RequestToTicketStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.requestToTicketReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -256,15 +321,16 @@ func (fake *FakeAuthPubTkt) SignTicket(arg1 *pubtkt.Ticket) error {
 	fake.signTicketArgsForCall = append(fake.signTicketArgsForCall, struct {
 		arg1 *pubtkt.Ticket
 	}{arg1})
+	stub := fake.SignTicketStub
+	fakeReturns := fake.signTicketReturns
 	fake.recordInvocation("SignTicket", []interface{}{arg1})
 	fake.signTicketMutex.Unlock()
-	if fake.SignTicketStub != nil {
-		return fake.SignTicketStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.signTicketReturns
 	return fakeReturns.result1
 }
 
@@ -317,15 +383,16 @@ func (fake *FakeAuthPubTkt) TicketInHeader(arg1 http.Header, arg2 *pubtkt.Ticket
 		arg1 http.Header
 		arg2 *pubtkt.Ticket
 	}{arg1, arg2})
+	stub := fake.TicketInHeaderStub
+	fakeReturns := fake.ticketInHeaderReturns
 	fake.recordInvocation("TicketInHeader", []interface{}{arg1, arg2})
 	fake.ticketInHeaderMutex.Unlock()
-	if fake.TicketInHeaderStub != nil {
-		return fake.TicketInHeaderStub(arg1, arg2)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.ticketInHeaderReturns
 	return fakeReturns.result1
 }
 
@@ -378,15 +445,16 @@ func (fake *FakeAuthPubTkt) TicketInRequest(arg1 *http.Request, arg2 *pubtkt.Tic
 		arg1 *http.Request
 		arg2 *pubtkt.Ticket
 	}{arg1, arg2})
+	stub := fake.TicketInRequestStub
+	fakeReturns := fake.ticketInRequestReturns
 	fake.recordInvocation("TicketInRequest", []interface{}{arg1, arg2})
 	fake.ticketInRequestMutex.Unlock()
-	if fake.TicketInRequestStub != nil {
-		return fake.TicketInRequestStub(arg1, arg2)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.ticketInRequestReturns
 	return fakeReturns.result1
 }
 
@@ -439,15 +507,16 @@ func (fake *FakeAuthPubTkt) TicketInResponse(arg1 http.ResponseWriter, arg2 *pub
 		arg1 http.ResponseWriter
 		arg2 *pubtkt.Ticket
 	}{arg1, arg2})
+	stub := fake.TicketInResponseStub
+	fakeReturns := fake.ticketInResponseReturns
 	fake.recordInvocation("TicketInResponse", []interface{}{arg1, arg2})
 	fake.ticketInResponseMutex.Unlock()
-	if fake.TicketInResponseStub != nil {
-		return fake.TicketInResponseStub(arg1, arg2)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.ticketInResponseReturns
 	return fakeReturns.result1
 }
 
@@ -499,15 +568,16 @@ func (fake *FakeAuthPubTkt) TicketToRaw(arg1 *pubtkt.Ticket) (string, error) {
 	fake.ticketToRawArgsForCall = append(fake.ticketToRawArgsForCall, struct {
 		arg1 *pubtkt.Ticket
 	}{arg1})
+	stub := fake.TicketToRawStub
+	fakeReturns := fake.ticketToRawReturns
 	fake.recordInvocation("TicketToRaw", []interface{}{arg1})
 	fake.ticketToRawMutex.Unlock()
-	if fake.TicketToRawStub != nil {
-		return fake.TicketToRawStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.ticketToRawReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -562,15 +632,16 @@ func (fake *FakeAuthPubTkt) VerifyFromRequest(arg1 *http.Request) (*pubtkt.Ticke
 	fake.verifyFromRequestArgsForCall = append(fake.verifyFromRequestArgsForCall, struct {
 		arg1 *http.Request
 	}{arg1})
+	stub := fake.VerifyFromRequestStub
+	fakeReturns := fake.verifyFromRequestReturns
 	fake.recordInvocation("VerifyFromRequest", []interface{}{arg1})
 	fake.verifyFromRequestMutex.Unlock()
-	if fake.VerifyFromRequestStub != nil {
-		return fake.VerifyFromRequestStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.verifyFromRequestReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -626,15 +697,16 @@ func (fake *FakeAuthPubTkt) VerifyTicket(arg1 *pubtkt.Ticket, arg2 string) error
 		arg1 *pubtkt.Ticket
 		arg2 string
 	}{arg1, arg2})
+	stub := fake.VerifyTicketStub
+	fakeReturns := fake.verifyTicketReturns
 	fake.recordInvocation("VerifyTicket", []interface{}{arg1, arg2})
 	fake.verifyTicketMutex.Unlock()
-	if fake.VerifyTicketStub != nil {
-		return fake.VerifyTicketStub(arg1, arg2)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.verifyTicketReturns
 	return fakeReturns.result1
 }
 
@@ -683,6 +755,8 @@ func (fake *FakeAuthPubTkt) VerifyTicketReturnsOnCall(i int, result1 error) {
 func (fake *FakeAuthPubTkt) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
 	fake.rawToTicketMutex.RLock()
 	defer fake.rawToTicketMutex.RUnlock()
 	fake.requestToTicketMutex.RLock()
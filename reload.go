@@ -0,0 +1,205 @@
+package pubtkt
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReloadErrorFunc is called when key material can't be reloaded from files after a change,
+// previous key material is kept in use.
+var ReloadErrorFunc = func(err error) {
+	log.Printf("go-auth-pubtkt: keeping previous keys, error when reloading files: %s", err.Error())
+}
+
+// fileWatcher calls a reload function each time one of the watched files changes.
+// Parent directories are watched instead of files themselves to follow files
+// replaced by a rename or by a symlink swap (e.g. kubernetes secrets).
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	files   map[string]bool
+	reload  func()
+	done    chan struct{}
+}
+
+func newFileWatcher(files []string, reload func()) (*fileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	fw := &fileWatcher{
+		watcher: watcher,
+		files:   make(map[string]bool),
+		reload:  reload,
+		done:    make(chan struct{}),
+	}
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		file = filepath.Clean(file)
+		fw.files[file] = true
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		err = watcher.Add(dir)
+		if err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("error when watching %s: %s", dir, err.Error())
+		}
+	}
+	go fw.run()
+	return fw, nil
+}
+
+func (w *fileWatcher) run() {
+	defer close(w.done)
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if w.isWatched(event.Name) {
+				w.reload()
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			ReloadErrorFunc(err)
+		}
+	}
+}
+
+// isWatched tells if an event on the given path can change a watched file,
+// kubernetes atomic writer swaps a ..data symlink to update files.
+func (w *fileWatcher) isWatched(path string) bool {
+	path = filepath.Clean(path)
+	return w.files[path] || strings.HasPrefix(filepath.Base(path), "..")
+}
+
+// Close stops watching files
+func (w *fileWatcher) Close() error {
+	err := w.watcher.Close()
+	<-w.done
+	return err
+}
+
+// readSecretFile reads a file containing a passphrase or a key, trailing new lines are removed
+// An empty file is an error, it is most likely being written.
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimRight(string(content), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// optionsFiles gives the files to read and watch for the given options
+func optionsFiles(options AuthPubTktOptions) []string {
+	files := make([]string, 0)
+	for _, file := range []string{
+		options.TKTAuthPublicKeyFile,
+		options.TKTAuthPrivateKeyFile,
+		options.TKTAuthPrivateKeyPassphraseFile,
+		options.TKTCypherTicketsWithPasswdFile,
+		options.TKTAuthSecretFile,
+	} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// checkOptionsFiles ensures that a value is not given both directly and as a file
+func checkOptionsFiles(options AuthPubTktOptions) error {
+	if options.TKTAuthPublicKey != "" && options.TKTAuthPublicKeyFile != "" {
+		return fmt.Errorf("TKTAuthPublicKey and TKTAuthPublicKeyFile can't be set at the same time")
+	}
+	if options.TKTAuthPrivateKey != "" && options.TKTAuthPrivateKeyFile != "" {
+		return fmt.Errorf("TKTAuthPrivateKey and TKTAuthPrivateKeyFile can't be set at the same time")
+	}
+	if options.TKTAuthPrivateKeyPassphrase != "" && options.TKTAuthPrivateKeyPassphraseFile != "" {
+		return fmt.Errorf("TKTAuthPrivateKeyPassphrase and TKTAuthPrivateKeyPassphraseFile can't be set at the same time")
+	}
+	if (options.TKTAuthPrivateKeyPassphrase != "" || options.TKTAuthPrivateKeyPassphraseFile != "") &&
+		options.TKTAuthPrivateKey == "" && options.TKTAuthPrivateKeyFile == "" {
+		return fmt.Errorf("TKTAuthPrivateKeyPassphrase can't be used without TKTAuthPrivateKey or TKTAuthPrivateKeyFile")
+	}
+	signers := 0
+	for _, isSet := range []bool{
+		options.TKTAuthPrivateKey != "" || options.TKTAuthPrivateKeyFile != "",
+		options.TKTAuthSigner != nil,
+		options.TKTAuthAgentSocket != "",
+	} {
+		if isSet {
+			signers++
+		}
+	}
+	if signers > 1 {
+		return fmt.Errorf("only one of TKTAuthPrivateKey, TKTAuthPrivateKeyFile, TKTAuthSigner or TKTAuthAgentSocket can be set")
+	}
+	if options.TKTAuthAgentKey != "" && options.TKTAuthAgentSocket == "" {
+		return fmt.Errorf("TKTAuthAgentKey can't be used without TKTAuthAgentSocket")
+	}
+	if options.TKTCypherTicketsWithPasswd != "" && options.TKTCypherTicketsWithPasswdFile != "" {
+		return fmt.Errorf("TKTCypherTicketsWithPasswd and TKTCypherTicketsWithPasswdFile can't be set at the same time")
+	}
+	if options.TKTAuthPassthruBasicKey != "" && options.TKTAuthPassthruBasicKeyFile != "" {
+		return fmt.Errorf("TKTAuthPassthruBasicKey and TKTAuthPassthruBasicKeyFile can't be set at the same time")
+	}
+	if options.TKTAuthSecret != "" && options.TKTAuthSecretFile != "" {
+		return fmt.Errorf("TKTAuthSecret and TKTAuthSecretFile can't be set at the same time")
+	}
+	if (options.TKTAuthSecret != "" || options.TKTAuthSecretFile != "") &&
+		(options.TKTAuthPublicKey != "" || options.TKTAuthPublicKeyFile != "" || len(options.TKTAuthPublicKeys) > 0 || signers > 0) {
+		return fmt.Errorf("TKTAuthSecret can't be used with public or private keys")
+	}
+	return nil
+}
+
+// loadOptionsFiles gives options with values read from files set in place of the file options
+func loadOptionsFiles(options AuthPubTktOptions) (AuthPubTktOptions, error) {
+	var err error
+	if options.TKTAuthPublicKeyFile != "" {
+		options.TKTAuthPublicKey, err = readSecretFile(options.TKTAuthPublicKeyFile)
+		if err != nil {
+			return options, fmt.Errorf("error when reading TKTAuthPublicKeyFile: %s", err.Error())
+		}
+	}
+	if options.TKTAuthPrivateKeyFile != "" {
+		options.TKTAuthPrivateKey, err = readSecretFile(options.TKTAuthPrivateKeyFile)
+		if err != nil {
+			return options, fmt.Errorf("error when reading TKTAuthPrivateKeyFile: %s", err.Error())
+		}
+	}
+	if options.TKTAuthPrivateKeyPassphraseFile != "" {
+		options.TKTAuthPrivateKeyPassphrase, err = readSecretFile(options.TKTAuthPrivateKeyPassphraseFile)
+		if err != nil {
+			return options, fmt.Errorf("error when reading TKTAuthPrivateKeyPassphraseFile: %s", err.Error())
+		}
+	}
+	if options.TKTCypherTicketsWithPasswdFile != "" {
+		options.TKTCypherTicketsWithPasswd, err = readSecretFile(options.TKTCypherTicketsWithPasswdFile)
+		if err != nil {
+			return options, fmt.Errorf("error when reading TKTCypherTicketsWithPasswdFile: %s", err.Error())
+		}
+	}
+	if options.TKTAuthSecretFile != "" {
+		options.TKTAuthSecret, err = readSecretFile(options.TKTAuthSecretFile)
+		if err != nil {
+			return options, fmt.Errorf("error when reading TKTAuthSecretFile: %s", err.Error())
+		}
+	}
+	return options, nil
+}
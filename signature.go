@@ -0,0 +1,350 @@
+package pubtkt
+
+import (
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// authKeys holds the key material parsed from options, it is parsed once
+// when creating AuthPubTkt to not decode keys on each ticket.
+type authKeys struct {
+	// verifyKeys are the keys trusted to verify ticket signatures
+	verifyKeys []verifyKey
+	// signer is used to create ticket signatures, nil if no private key has been given
+	signer Signer
+	// signatureAlgorithm is the algorithm to give to signer for creating ticket signatures
+	signatureAlgorithm string
+	// cipherPasswds are the passphrases to decrypt tickets with, the first one is used to encrypt tickets
+	cipherPasswds []string
+	// policy restricts the algorithms allowed to create and verify ticket signatures
+	policy algorithmPolicy
+	// secret is the shared secret of mod_auth_tkt tickets
+	secret string
+}
+
+// verifyKey is a public key from the verification keyring
+type verifyKey struct {
+	id        string
+	publicKey crypto.PublicKey
+	notAfter  time.Time
+	// certificate is set when the key has been given as a X.509 certificate,
+	// its chain is verified when the key is loaded, certNotBefore and certNotAfter are the validity window of the chain
+	certificate   *x509.Certificate
+	certNotBefore time.Time
+	certNotAfter  time.Time
+}
+
+// check ensures that the key can be trusted at the given time
+func (k verifyKey) check(now time.Time) error {
+	if !k.notAfter.IsZero() && now.After(k.notAfter) {
+		return fmt.Errorf("key %s is expired", k.id)
+	}
+	if k.certificate != nil && (now.Before(k.certNotBefore) || now.After(k.certNotAfter)) {
+		return fmt.Errorf("certificate of key %s is not valid: current time %s is outside of the validity window of its chain",
+			k.id, now.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (k *authKeys) verifyKey(id string) (verifyKey, bool) {
+	for _, key := range k.verifyKeys {
+		if key.id == id {
+			return key, true
+		}
+	}
+	return verifyKey{}, false
+}
+
+func newAuthKeys(options AuthPubTktOptions) (*authKeys, error) {
+	keys := &authKeys{
+		secret: options.TKTAuthSecret,
+	}
+	if options.TKTCypherTicketsWithPasswd != "" {
+		keys.cipherPasswds = append(keys.cipherPasswds, options.TKTCypherTicketsWithPasswd)
+	}
+	for _, cipherPasswd := range options.TKTCypherTicketsWithPasswds {
+		if cipherPasswd == "" {
+			return nil, fmt.Errorf("TKTCypherTicketsWithPasswds can't contain an empty passphrase")
+		}
+		keys.cipherPasswds = append(keys.cipherPasswds, cipherPasswd)
+	}
+	var err error
+	keys.policy, err = newAlgorithmPolicy(options)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := parseCACerts(options.TKTAuthCACerts)
+	if err != nil {
+		return nil, fmt.Errorf("error with TKTAuthCACerts: %s", err.Error())
+	}
+	certKeyUsages, err := parseExtKeyUsages(options.TKTAuthCertExtKeyUsages)
+	if err != nil {
+		return nil, fmt.Errorf("error with TKTAuthCertExtKeyUsages: %s", err.Error())
+	}
+	trustedKeys := options.TKTAuthPublicKeys
+	if options.TKTAuthPublicKey != "" {
+		trustedKeys = append([]AuthPubTktKey{{PublicKey: options.TKTAuthPublicKey}}, trustedKeys...)
+	}
+	for i, trustedKey := range trustedKeys {
+		key, err := newVerifyKey(trustedKey, options.TKTAuthDigest, roots, certKeyUsages)
+		if err != nil {
+			if i == 0 && options.TKTAuthPublicKey != "" {
+				return nil, fmt.Errorf("error with TKTAuthPublicKey: %s", err.Error())
+			}
+			return nil, fmt.Errorf("error with key %s in TKTAuthPublicKeys: %s", trustedKey.KeyID, err.Error())
+		}
+		if _, exists := keys.verifyKey(key.id); exists {
+			return nil, fmt.Errorf("key id %s is used by more than one public key", key.id)
+		}
+		keys.verifyKeys = append(keys.verifyKeys, key)
+	}
+	switch {
+	case options.TKTAuthSigner != nil:
+		keys.signer = options.TKTAuthSigner
+	case options.TKTAuthAgentSocket != "":
+		keys.signer, err = newAgentSigner(options.TKTAuthAgentSocket, options.TKTAuthAgentKey)
+		if err != nil {
+			return nil, fmt.Errorf("error with TKTAuthAgentSocket: %s", err.Error())
+		}
+	case options.TKTAuthPrivateKey != "":
+		if options.TKTAuthPrivateKeyPassphrase != "" {
+			keys.signer, err = ParsePrivateKeyWithPassphrase([]byte(options.TKTAuthPrivateKey), []byte(options.TKTAuthPrivateKeyPassphrase))
+		} else {
+			keys.signer, err = ParsePrivateKey([]byte(options.TKTAuthPrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error when parse TKTAuthPrivateKey: %s", err.Error())
+		}
+	default:
+		return keys, nil
+	}
+	keys.signatureAlgorithm, err = signatureAlgorithm(keys.signer.PublicKey(), options.TKTAuthDigest)
+	if err != nil {
+		return nil, fmt.Errorf("signing key can't be used with TKTAuthDigest: %s", err.Error())
+	}
+	if cryptoPub, ok := keys.signer.PublicKey().(ssh.CryptoPublicKey); ok {
+		err = keys.policy.check(cryptoPub.CryptoPublicKey(), options.TKTAuthDigest)
+		if err != nil {
+			return nil, fmt.Errorf("signing key can't be used: %s", err.Error())
+		}
+	}
+	if agentSigner, ok := keys.signer.(*agentSigner); ok {
+		_, err = agentSigner.signatureFlags(keys.signatureAlgorithm)
+		if err != nil {
+			return nil, fmt.Errorf("signing key can't be used with TKTAuthDigest: %s", err.Error())
+		}
+	}
+	return keys, nil
+}
+
+func newVerifyKey(trustedKey AuthPubTktKey, authDigest string, roots *x509.CertPool, certKeyUsages []x509.ExtKeyUsage) (verifyKey, error) {
+	var key verifyKey
+	var err error
+	if isCertificate(trustedKey.PublicKey) {
+		var certOpts x509.VerifyOptions
+		key.certificate, certOpts, err = parseCertificateChain(trustedKey.PublicKey, roots, certKeyUsages)
+		if err != nil {
+			return verifyKey{}, fmt.Errorf("error when parse certificate: %s", err.Error())
+		}
+		key.certNotBefore, key.certNotAfter, err = checkCertificate(key.certificate, certOpts, TimeNowFunc())
+		if err != nil {
+			return verifyKey{}, fmt.Errorf("certificate is not valid: %s", err.Error())
+		}
+		key.publicKey = key.certificate.PublicKey
+	} else {
+		key.publicKey, err = parsePublicKey(trustedKey.PublicKey)
+		if err != nil {
+			return verifyKey{}, fmt.Errorf("error when parse public key: %s", err.Error())
+		}
+	}
+	pub := key.publicKey
+	err = checkVerifyDigest(pub, authDigest)
+	if err != nil {
+		return verifyKey{}, fmt.Errorf("public key can't be used with TKTAuthDigest: %s", err.Error())
+	}
+	id := trustedKey.KeyID
+	if id == "" {
+		sshPub, err := NewPublicKey(pub)
+		if err != nil {
+			return verifyKey{}, err
+		}
+		id = FingerprintSHA256(sshPub)
+	}
+	key.id = id
+	key.notAfter = trustedKey.NotAfter
+	return key, nil
+}
+
+// parsePublicKey parses a PEM encoded PKIX public key or a public key
+// in OpenSSH authorized_keys format (e.g. the content of a .pub file created by ssh-keygen)
+func parsePublicKey(pemKey string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return parseAuthorizedPublicKey(pemKey)
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unsupported PEM block type %q, expecting \"PUBLIC KEY\"", block.Type)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func parseAuthorizedPublicKey(authorizedKey string) (crypto.PublicKey, error) {
+	pubKey, _, _, rest, err := ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return nil, fmt.Errorf("no PEM encoded key or authorized_keys line found")
+	}
+	if len(strings.TrimSpace(string(rest))) > 0 {
+		return nil, fmt.Errorf("only one authorized_keys line can be given by key")
+	}
+	cryptoPubKey, ok := pubKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported authorized_keys key type %s", pubKey.Type())
+	}
+	return cryptoPubKey.CryptoPublicKey(), nil
+}
+
+// checkVerifyDigest ensures that ticket signatures made with the given TKTAuthDigest
+// can be verified with the given public key.
+func checkVerifyDigest(pub crypto.PublicKey, authDigest string) error {
+	switch pub.(type) {
+	case *rsa.PublicKey, *dsa.PublicKey, *ecdsa.PublicKey:
+	case ed25519.PublicKey:
+		if authDigest != "" {
+			return fmt.Errorf("digest %s can't be used with an Ed25519 key", authDigest)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	digest, err := ticketDigest(pub, authDigest)
+	if err != nil {
+		return err
+	}
+	_, _, err = FindHash(digest)
+	return err
+}
+
+// ticketDigest returns the digest name (as understood by FindHash) to use for
+// ticket signatures made with the given key, according to the TKTAuthDigest option.
+// DSS1 is an alias of SHA1 and ECDSA keys default to the hash matching their curve.
+func ticketDigest(pubKey crypto.PublicKey, authDigest string) (string, error) {
+	authDigest = strings.ToLower(authDigest)
+	if authDigest == "dss1" {
+		return string(Hsha1), nil
+	}
+	if authDigest != "" {
+		return authDigest, nil
+	}
+	if ecPub, ok := pubKey.(*ecdsa.PublicKey); ok {
+		if !supportedEllipticCurve(ecPub.Curve) {
+			return "", fmt.Errorf("only P-256, P-384 and P-521 EC keys are supported")
+		}
+		switch ecHash(ecPub.Curve) {
+		case crypto.SHA256:
+			return string(Hsha256), nil
+		case crypto.SHA384:
+			return string(Hsha384), nil
+		default:
+			return string(Hsha512), nil
+		}
+	}
+	return string(Hsha1), nil
+}
+
+// signatureAlgorithms gives, by key type, the signature algorithm to use
+// for each digest a ticket signature can be made with.
+var signatureAlgorithms = map[string]map[hashMethod]string{
+	KeyAlgoRSA: {
+		Hsha1:   SigAlgoRSA,
+		Hsha224: SigAlgoRSASHA2224,
+		Hsha256: SigAlgoRSASHA2256,
+		Hsha384: SigAlgoRSASHA2384,
+		Hsha512: SigAlgoRSASHA2512,
+	},
+	KeyAlgoDSA: {
+		Hsha1: KeyAlgoDSA,
+	},
+	KeyAlgoECDSA256: ecdsaSignatureAlgorithms,
+	KeyAlgoECDSA384: ecdsaSignatureAlgorithms,
+	KeyAlgoECDSA521: ecdsaSignatureAlgorithms,
+}
+
+var ecdsaSignatureAlgorithms = map[hashMethod]string{
+	Hsha1:   SigAlgoECDSASHA1,
+	Hsha224: SigAlgoECDSASHA224,
+	Hsha256: SigAlgoECDSASHA256,
+	Hsha384: SigAlgoECDSASHA384,
+	Hsha512: SigAlgoECDSASHA512,
+}
+
+// signatureAlgorithm gives the signature algorithm to ask to a Signer to create
+// a ticket signature with the given key and TKTAuthDigest option.
+func signatureAlgorithm(pubKey PublicKey, authDigest string) (string, error) {
+	if pubKey.Type() == KeyAlgoED25519 {
+		if authDigest != "" {
+			return "", fmt.Errorf("digest %s can't be used with key type %s", authDigest, pubKey.Type())
+		}
+		return KeyAlgoED25519, nil
+	}
+	algorithms, ok := signatureAlgorithms[pubKey.Type()]
+	if !ok {
+		return "", fmt.Errorf("unsupported key type %s", pubKey.Type())
+	}
+	cryptoPub, ok := pubKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return "", fmt.Errorf("unsupported key type %s", pubKey.Type())
+	}
+	digest, err := ticketDigest(cryptoPub.CryptoPublicKey(), authDigest)
+	if err != nil {
+		return "", err
+	}
+	algorithm, ok := algorithms[hashMethod(digest)]
+	if !ok {
+		return "", fmt.Errorf("digest %s can't be used with key type %s", digest, pubKey.Type())
+	}
+	return algorithm, nil
+}
+
+func signWithAlgorithm(signer Signer, data []byte, algorithm string) (*ssh.Signature, error) {
+	algoSigner, ok := signer.(AlgorithmSigner)
+	if !ok {
+		if algorithm != signer.PublicKey().Type() {
+			return nil, fmt.Errorf("signer doesn't support signature algorithm %s", algorithm)
+		}
+		return signer.Sign(rand.Reader, data)
+	}
+	return algoSigner.SignWithAlgorithm(rand.Reader, data, algorithm)
+}
+
+// ticketSignatureBlob converts a signature in SSH wire format to the format
+// expected in a ticket, which is the one OpenSSL produces
+// (ASN.1 DER encoded r and s for ECDSA, raw signature for RSA).
+func ticketSignatureBlob(sig *ssh.Signature) ([]byte, error) {
+	switch sig.Format {
+	case KeyAlgoECDSA256, KeyAlgoECDSA384, KeyAlgoECDSA521,
+		SigAlgoECDSASHA1, SigAlgoECDSASHA224, SigAlgoECDSASHA256, SigAlgoECDSASHA384, SigAlgoECDSASHA512:
+		var ecSig struct {
+			R *big.Int
+			S *big.Int
+		}
+		if err := ssh.Unmarshal(sig.Blob, &ecSig); err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(ecSig)
+	default:
+		return sig.Blob, nil
+	}
+}
@@ -0,0 +1,117 @@
+package pubtkt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// DefaultUdataMaxSize is the maximum size of encoded udata used when no size is given to udata helpers,
+// tickets are mostly given in cookies which are limited to 4096 bytes
+const DefaultUdataMaxSize = 1024
+
+// EncodeUdata gives v as udata: json encoded in base64url (without padding).
+// It gives ErrUdataTooLarge if udata is larger than maxSize bytes (DefaultUdataMaxSize if maxSize is 0).
+func EncodeUdata[T any](v T, maxSize int) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	udata := base64.RawURLEncoding.EncodeToString(data)
+	err = checkUdataSize(udata, maxSize)
+	if err != nil {
+		return "", err
+	}
+	return udata, nil
+}
+
+// DecodeUdata gives the value encoded with EncodeUdata in udata, the zero value of T if udata is empty.
+// It gives ErrUdataTooLarge if udata is larger than maxSize bytes (DefaultUdataMaxSize if maxSize is 0)
+// and ErrUdataNotValid if it is not json encoded in base64url.
+func DecodeUdata[T any](udata string, maxSize int) (T, error) {
+	var v T
+	if udata == "" {
+		return v, nil
+	}
+	err := checkUdataSize(udata, maxSize)
+	if err != nil {
+		return v, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(udata, "="))
+	if err != nil {
+		return v, NewErrUdataNotValid(err)
+	}
+	err = json.Unmarshal(data, &v)
+	if err != nil {
+		return v, NewErrUdataNotValid(err)
+	}
+	return v, nil
+}
+
+// SetTicketUdata sets udata of the ticket with v encoded with EncodeUdata, ticket must be signed afterward
+func SetTicketUdata[T any](ticket *Ticket, v T, maxSize int) error {
+	udata, err := EncodeUdata(v, maxSize)
+	if err != nil {
+		return err
+	}
+	ticket.Udata = udata
+	return nil
+}
+
+// UdataRequest gives the value encoded with EncodeUdata in udata of the ticket set in the request by AuthPubTktHandler
+// (see TicketRequest and DecodeUdata), it gives ErrNoTicket if there is no ticket in the request.
+// Udata is decoded once per request for each type, the value is then given from a cache kept in the request context.
+func UdataRequest[T any](req *http.Request, maxSize int) (T, error) {
+	ticket := TicketRequest(req)
+	if ticket == nil {
+		var v T
+		return v, NewErrNoTicket()
+	}
+	cache, _ := req.Context().Value(udataKey).(*udataCache)
+	if cache == nil {
+		return DecodeUdata[T](ticket.Udata, maxSize)
+	}
+	key := udataCacheKey{typ: reflect.TypeOf((*T)(nil)).Elem(), udata: ticket.Udata, maxSize: maxSize}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if decoded, ok := cache.values[key]; ok {
+		return decoded.value.(T), decoded.err
+	}
+	v, err := DecodeUdata[T](ticket.Udata, maxSize)
+	cache.values[key] = udataDecoded{value: v, err: err}
+	return v, err
+}
+
+// udataCache keeps values decoded by UdataRequest during a request
+type udataCache struct {
+	mu     sync.Mutex
+	values map[udataCacheKey]udataDecoded
+}
+
+type udataCacheKey struct {
+	typ     reflect.Type
+	udata   string
+	maxSize int
+}
+
+type udataDecoded struct {
+	value any
+	err   error
+}
+
+func newUdataCache() *udataCache {
+	return &udataCache{values: make(map[udataCacheKey]udataDecoded)}
+}
+
+func checkUdataSize(udata string, maxSize int) error {
+	if maxSize == 0 {
+		maxSize = DefaultUdataMaxSize
+	}
+	if len(udata) > maxSize {
+		return NewErrUdataTooLarge(len(udata), maxSize)
+	}
+	return nil
+}
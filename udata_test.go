@@ -0,0 +1,125 @@
+package pubtkt_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/orange-cloudfoundry/go-auth-pubtkt"
+	. "github.com/orange-cloudfoundry/go-auth-pubtkt/pubtktfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type userData struct {
+	DisplayName string `json:"display_name"`
+	Tenant      string `json:"tenant"`
+	Locale      string `json:"locale,omitempty"`
+}
+
+// countingData counts how many times it has been decoded
+type countingData struct {
+	Tenant string `json:"tenant"`
+}
+
+var countingDataDecodes int
+
+func (c *countingData) UnmarshalJSON(data []byte) error {
+	countingDataDecodes++
+	type plain countingData
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+var _ = Describe("Udata", func() {
+	data := userData{DisplayName: "My User; admin=true", Tenant: "t1", Locale: "fr"}
+
+	It("should encode a value as base64url json and decode it back", func() {
+		udata, err := EncodeUdata(data, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(udata).To(Equal("eyJkaXNwbGF5X25hbWUiOiJNeSBVc2VyOyBhZG1pbj10cnVlIiwidGVuYW50IjoidDEiLCJsb2NhbGUiOiJmciJ9"))
+
+		decoded, err := DecodeUdata[userData](udata, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal(data))
+
+		decoded, err = DecodeUdata[userData]("", 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(BeZero())
+	})
+	It("should refuse udata larger than the max size", func() {
+		_, err := EncodeUdata(data, 16)
+		Expect(err).To(BeAssignableToTypeOf(ErrUdataTooLarge("")))
+
+		_, err = EncodeUdata(strings.Repeat("a", DefaultUdataMaxSize), 0)
+		Expect(err).To(BeAssignableToTypeOf(ErrUdataTooLarge("")))
+
+		_, err = DecodeUdata[userData](strings.Repeat("a", 17), 16)
+		Expect(err).To(BeAssignableToTypeOf(ErrUdataTooLarge("")))
+	})
+	It("should refuse udata which is not base64url json", func() {
+		for _, udata := range []string{"not base64", "bm90IGpzb24", "WzFd"} {
+			_, err := DecodeUdata[userData](udata, 0)
+			Expect(err).To(BeAssignableToTypeOf(ErrUdataNotValid("")), udata)
+		}
+	})
+	It("should give the value from the ticket in the request", func() {
+		fakePubTkt := new(FakeAuthPubTkt)
+		ticket := &Ticket{Uid: "user"}
+		err := SetTicketUdata(ticket, data, 0)
+		Expect(err).ToNot(HaveOccurred())
+		fakePubTkt.VerifyFromRequestReturns(ticket, nil)
+
+		var decoded userData
+		h, err := NewAuthPubTktHandler(
+			AuthPubTktOptions{TKTAuthLoginURL: "fake"},
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				decoded, err = UdataRequest[userData](req, 0)
+			}),
+			SetCreateAuthPubTktFunc(func(options AuthPubTktOptions) (AuthPubTkt, error) {
+				return fakePubTkt, nil
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		req, _ := http.NewRequest("GET", "http://localhost.com", nil)
+
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal(data))
+
+		_, err = UdataRequest[userData](httptest.NewRequest("GET", "http://localhost.com", nil), 0)
+		Expect(err).To(BeAssignableToTypeOf(ErrNoTicket("")))
+	})
+	It("should decode udata once per request", func() {
+		fakePubTkt := new(FakeAuthPubTkt)
+		ticket := &Ticket{Uid: "user"}
+		err := SetTicketUdata(ticket, countingData{Tenant: "t1"}, 0)
+		Expect(err).ToNot(HaveOccurred())
+		fakePubTkt.VerifyFromRequestReturns(ticket, nil)
+
+		var first, second countingData
+		var firstErr, secondErr error
+		h, err := NewAuthPubTktHandler(
+			AuthPubTktOptions{TKTAuthLoginURL: "fake"},
+			http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				first, firstErr = UdataRequest[countingData](req, 0)
+				second, secondErr = UdataRequest[countingData](req, 0)
+			}),
+			SetCreateAuthPubTktFunc(func(options AuthPubTktOptions) (AuthPubTkt, error) {
+				return fakePubTkt, nil
+			}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		countingDataDecodes = 0
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost.com", nil))
+
+		Expect(firstErr).ToNot(HaveOccurred())
+		Expect(secondErr).ToNot(HaveOccurred())
+		Expect(first).To(Equal(countingData{Tenant: "t1"}))
+		Expect(second).To(Equal(first))
+		Expect(countingDataDecodes).To(Equal(1))
+	})
+})